@@ -0,0 +1,94 @@
+// Package commit implements a commit–reveal scheme based on BLAKE2b.
+//
+// A player commits to a value by publishing a Commitment, which reveals
+// nothing about the value. Later, the player publishes the Opening, and other
+// players Verify that it matches the Commitment, such that the value could not
+// have been changed after seeing the values of other players.
+//
+// Commitments are hiding because the value is hashed together with a random
+// salt, and binding because BLAKE2b-256 is collision resistant. Every
+// commitment is bound to a Domain, such that a commitment made for a game,
+// phase or player cannot be replayed as a commitment for another.
+package commit
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Size is the size of a Commitment in bytes.
+const Size = blake2b.Size256
+
+// SaltSize is the size of the random salt of an Opening in bytes.
+const SaltSize = 32
+
+// ErrInvalidOpening is returned by Verify when an Opening does not match a
+// Commitment.
+var ErrInvalidOpening = errors.New("commit: opening does not match commitment")
+
+// A Commitment binds its author to a value without revealing it.
+type Commitment [Size]byte
+
+// An Opening reveals the value of a Commitment.
+type Opening struct {
+	Value []byte
+	Salt  [SaltSize]byte
+}
+
+// A Domain identifies the context of a Commitment.
+type Domain struct {
+	GameID string
+	Phase  string // e.g., "gameplay order"
+	Player int    // author of the commitment
+}
+
+// Commit commits to value in domain d, returning the Commitment to publish and
+// the Opening to keep secret until the reveal. The salt is read from random; if
+// random is nil, crypto/rand.Reader is used.
+func Commit(random io.Reader, d Domain, value []byte) (Commitment, Opening, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	o := Opening{Value: append([]byte(nil), value...)}
+	if _, err := io.ReadFull(random, o.Salt[:]); err != nil {
+		return Commitment{}, Opening{}, fmt.Errorf("commit: cannot generate salt: %w", err)
+	}
+	return digest(d, o), o, nil
+}
+
+// Verify returns ErrInvalidOpening if o is not the opening of c in domain d.
+func Verify(d Domain, c Commitment, o Opening) error {
+	if digest(d, o) != c {
+		return ErrInvalidOpening
+	}
+	return nil
+}
+
+// digest returns the BLAKE2b-256 hash of the unambiguous encoding of d and o.
+func digest(d Domain, o Opening) Commitment {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/commit\x00"))
+	writeBytes(h, []byte(d.GameID))
+	writeBytes(h, []byte(d.Phase))
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(d.Player))
+	h.Write(b[:])
+	h.Write(o.Salt[:])
+	writeBytes(h, o.Value)
+	var c Commitment
+	h.Sum(c[:0])
+	return c
+}
+
+// writeBytes writes b to w prefixed with its length.
+func writeBytes(w io.Writer, b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	w.Write(n[:])
+	w.Write(b)
+}
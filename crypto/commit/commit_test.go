@@ -0,0 +1,63 @@
+package commit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommit(t *testing.T) {
+	d := Domain{GameID: "game", Phase: "phase", Player: 1}
+	value := []byte("value")
+	c, o, err := Commit(nil, d, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(d, c, o); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	value[0] = 'V'
+	if err := Verify(d, c, o); err != nil {
+		t.Errorf("Verify after changing the committed slice: %v", err)
+	}
+
+	// Committing again to the same value yields a different commitment.
+	c2, o2, err := Commit(nil, d, o.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c {
+		t.Errorf("same commitment for the same value")
+	}
+
+	tests := []struct {
+		name string
+		d    Domain
+		c    Commitment
+		o    Opening
+	}{
+		{"other game", Domain{"other", d.Phase, d.Player}, c, o},
+		{"other phase", Domain{d.GameID, "other", d.Player}, c, o},
+		{"other player", Domain{d.GameID, d.Phase, 2}, c, o},
+		{"other value", d, c, Opening{Value: []byte("other"), Salt: o.Salt}},
+		{"other salt", d, c, Opening{Value: o.Value, Salt: o2.Salt}},
+		{"other commitment", d, c2, o},
+		// Fields are length-prefixed, moving bytes between them
+		// changes the commitment.
+		{"ambiguous domain", Domain{"gam", "ephase", d.Player}, c, o},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.d, tt.c, tt.o); !errors.Is(err, ErrInvalidOpening) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, ErrInvalidOpening)
+		}
+	}
+}
+
+type brokenReader struct{}
+
+func (brokenReader) Read(p []byte) (int, error) { return 0, errors.New("broken") }
+
+func TestCommitBrokenRandom(t *testing.T) {
+	if _, _, err := Commit(brokenReader{}, Domain{}, nil); err == nil {
+		t.Error("got nil error, want error")
+	}
+}
@@ -0,0 +1,36 @@
+// Package commutative defines the interface of commutative encryption schemes,
+// in which a message encrypted with several keys can be decrypted with the
+// same keys in any order.
+//
+// Game code depends on these interfaces rather than on a specific scheme. The
+// schemes in package sra, modular exponentiation and elliptic curves, implement
+// them, and any new scheme must pass the conformance tests in package
+// commutativetest.
+package commutative
+
+// Params are the public parameters of a commutative encryption scheme. Keys
+// can only be used together if their Params have the same ID.
+type Params interface {
+	// ID returns a digest identifying the scheme and its parameters.
+	ID() [32]byte
+	// CheckCiphertext returns an error if ciphertext cannot have been
+	// produced by encryption with keys using these parameters.
+	CheckCiphertext(ciphertext []byte) error
+}
+
+// A Key encrypts and decrypts messages with a commutative encryption scheme.
+// A message encrypted with keys k1, k2, ..., kn, in any order, is recovered by
+// decrypting with the same keys, in any order.
+type Key interface {
+	// Encrypt encrypts plaintext. It returns an error if plaintext is not
+	// a valid message for the scheme.
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt decrypts ciphertext. It returns an error if ciphertext is
+	// not valid, see Params.CheckCiphertext.
+	Decrypt(ciphertext []byte) ([]byte, error)
+	// Params returns the parameters of the key.
+	Params() Params
+	// Fingerprint returns a short string that identifies the key without
+	// revealing it. Distinct keys have distinct fingerprints.
+	Fingerprint() string
+}
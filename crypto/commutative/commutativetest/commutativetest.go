@@ -0,0 +1,224 @@
+// Package commutativetest implements conformance tests for implementations of
+// the interfaces in package commutative.
+package commutativetest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+// MaxKeys is the largest number of keys combined in the tests.
+const MaxKeys = 4
+
+// A Backend describes the implementation under test.
+type Backend struct {
+	// NewKey returns a new random key. All keys returned by NewKey must
+	// share the same parameters.
+	NewKey func() (commutative.Key, error)
+	// Codec encodes tiles as valid plaintexts for keys from NewKey.
+	Codec game.TileCodec
+	// Invalid is a ciphertext that keys from NewKey must reject, if not
+	// nil.
+	Invalid []byte
+}
+
+// Run runs the conformance tests for b.
+func Run(t *testing.T, b Backend) {
+	keys := make([]commutative.Key, MaxKeys)
+	for i := range keys {
+		key, err := b.NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	t.Run("Params", func(t *testing.T) { testParams(t, b, keys) })
+	t.Run("Fingerprint", func(t *testing.T) { testFingerprint(t, keys) })
+	t.Run("Commutativity", func(t *testing.T) { testCommutativity(t, b, keys) })
+	t.Run("Seal", func(t *testing.T) { testSeal(t, b, keys) })
+	if b.Invalid != nil {
+		t.Run("Invalid", func(t *testing.T) { testInvalid(t, b, keys) })
+	}
+}
+
+func testParams(t *testing.T, b Backend, keys []commutative.Key) {
+	id := keys[0].Params().ID()
+	for i, key := range keys {
+		if got := key.Params().ID(); got != id {
+			t.Fatalf("key #%d: Params().ID() = %x, want %x", i, got, id)
+		}
+	}
+	m := b.Codec.EncodeTile(game.Tile{Value: 1})
+	for i, key := range keys {
+		c, err := key.Encrypt(m)
+		if err != nil {
+			t.Fatalf("key #%d: Encrypt: %v", i, err)
+		}
+		if err := key.Params().CheckCiphertext(c); err != nil {
+			t.Errorf("key #%d: CheckCiphertext(Encrypt(m)) = %v, want nil", i, err)
+		}
+		m = c
+	}
+}
+
+func testFingerprint(t *testing.T, keys []commutative.Key) {
+	seen := make(map[string]int)
+	for i, key := range keys {
+		fp := key.Fingerprint()
+		if fp == "" {
+			t.Errorf("key #%d: empty fingerprint", i)
+		}
+		if again := key.Fingerprint(); again != fp {
+			t.Errorf("key #%d: unstable fingerprint: %q, then %q", i, fp, again)
+		}
+		if j, ok := seen[fp]; ok {
+			t.Errorf("keys #%d and #%d have the same fingerprint %q", j, i, fp)
+		}
+		seen[fp] = i
+	}
+}
+
+// testCommutativity checks that a message encrypted with n keys, for every n up
+// to MaxKeys and in every order, is decrypted with the same keys in every
+// order.
+func testCommutativity(t *testing.T, b Backend, keys []commutative.Key) {
+	m := b.Codec.EncodeTile(game.Tile{Value: 7, Color: 2})
+	for n := 1; n <= len(keys); n++ {
+		perms := permutations(n)
+		var want []byte
+		for i, enc := range perms {
+			c := m
+			for _, k := range enc {
+				var err error
+				if c, err = keys[k].Encrypt(c); err != nil {
+					t.Fatalf("Encrypt: %v", err)
+				}
+			}
+			// The ciphertext does not depend on the order of
+			// encryption.
+			if want == nil {
+				want = c
+			} else if !bytes.Equal(c, want) {
+				t.Fatalf("n=%d, order %v: ciphertext %x, want %x", n, enc, c, want)
+			}
+			// Decrypt in a different order, reversed when there is
+			// no other.
+			dec := perms[(i+1)%len(perms)]
+			if len(perms) == 1 {
+				dec = enc
+			}
+			for _, k := range dec {
+				var err error
+				if c, err = keys[k].Decrypt(c); err != nil {
+					t.Fatalf("Decrypt: %v", err)
+				}
+			}
+			if !bytes.Equal(c, m) {
+				t.Fatalf("n=%d, encrypted in order %v, decrypted in order %v: got %x, want %x", n, enc, dec, c, m)
+			}
+		}
+	}
+}
+
+// testSeal checks the semantics documented on game.ConcealedTile.
+func testSeal(t *testing.T, b Backend, keys []commutative.Key) {
+	tile := game.Tile{Value: 13, Color: 1}
+
+	once := game.Conceal(b.Codec, tile)
+	if err := once.Seal(keys...); err != nil {
+		t.Fatal(err)
+	}
+
+	twice := game.Conceal(b.Codec, tile)
+	for i := 0; i < 2; i++ {
+		if err := twice.Seal(keys...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := twice.Seal(keys[0], keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(twice.Bytes(), once.Bytes()) {
+		t.Errorf("sealing more than once: got %x, want %x", twice.Bytes(), once.Bytes())
+	}
+
+	if _, err := twice.Tile(); !errors.Is(err, game.ErrSealed) {
+		t.Errorf("Tile() of sealed tile: got error %v, want %v", err, game.ErrSealed)
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := twice.Open(keys[i], keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		// Opening with a key that no longer seals the tile
+		// is a no-op.
+		before := twice.Bytes()
+		if err := twice.Open(keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(twice.Bytes(), before) {
+			t.Fatalf("Open with key #%d twice changed the tile", i)
+		}
+		if _, err := twice.Tile(); i > 0 && !errors.Is(err, game.ErrSealed) {
+			t.Errorf("Tile() with %d keys left: got error %v, want %v", i, err, game.ErrSealed)
+		}
+	}
+	got, err := twice.Tile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != tile {
+		t.Errorf("Tile() = %v, want %v", *got, tile)
+	}
+
+	// A tile sealed by other players is opened with their keys.
+	sealed := game.Sealed(b.Codec, once.Bytes(), fingerprints(keys[1:])...)
+	if err := sealed.Open(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sealed.Tile(); !errors.Is(err, game.ErrSealed) {
+		t.Errorf("Tile() of tile sealed by others: got error %v, want %v", err, game.ErrSealed)
+	}
+}
+
+func testInvalid(t *testing.T, b Backend, keys []commutative.Key) {
+	if err := keys[0].Params().CheckCiphertext(b.Invalid); err == nil {
+		t.Errorf("CheckCiphertext(%x) = nil, want error", b.Invalid)
+	}
+	if _, err := keys[0].Decrypt(b.Invalid); err == nil {
+		t.Errorf("Decrypt(%x): want error", b.Invalid)
+	}
+	ct := game.Sealed(b.Codec, b.Invalid, keys[0].Fingerprint())
+	if err := ct.Open(keys[0]); err == nil {
+		t.Errorf("Open(%x): want error", b.Invalid)
+	}
+}
+
+func fingerprints(keys []commutative.Key) []string {
+	fps := make([]string, len(keys))
+	for i, key := range keys {
+		fps[i] = key.Fingerprint()
+	}
+	return fps
+}
+
+// permutations returns all permutations of 0, 1, ..., n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var out [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := make([]int, 0, n)
+			q = append(q, p[:i]...)
+			q = append(q, n-1)
+			q = append(q, p[i:]...)
+			out = append(out, q)
+		}
+	}
+	return out
+}
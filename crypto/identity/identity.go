@@ -0,0 +1,80 @@
+// Package identity implements long-term Ed25519 identities of players, and
+// signatures of the messages they send.
+//
+// A signature covers the game ID, the sequence number of the message among
+// those sent by the player in the game, and the payload. A message can thus be
+// neither attributed to another player, nor replayed in another game or at
+// another point of the same game.
+package identity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrInvalidSignature is returned by Verify when a signature does not match.
+var ErrInvalidSignature = errors.New("identity: invalid signature")
+
+// ErrInvalidPublicKey is returned when decoding a malformed public key.
+var ErrInvalidPublicKey = errors.New("identity: invalid public key")
+
+// New returns a new random identity. If random is nil, crypto/rand.Reader is
+// used.
+func New(random io.Reader) (ed25519.PrivateKey, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(random, seed); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Sign signs the message with sequence number seq in the game identified by
+// gameID.
+func Sign(key ed25519.PrivateKey, gameID string, seq uint64, payload []byte) []byte {
+	return ed25519.Sign(key, signed(gameID, seq, payload))
+}
+
+// Verify returns ErrInvalidSignature if sig is not the signature by pub of the
+// message with sequence number seq in the game identified by gameID.
+func Verify(pub ed25519.PublicKey, gameID string, seq uint64, payload, sig []byte) error {
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, signed(gameID, seq, payload), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// signed returns the signed encoding of a message.
+func signed(gameID string, seq uint64, payload []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("tiwe/identity message\x00")
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(gameID)))
+	b.Write(n[:])
+	b.WriteString(gameID)
+	binary.BigEndian.PutUint64(n[:], seq)
+	b.Write(n[:])
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// Encode returns a printable encoding of pub, used to name players.
+func Encode(pub ed25519.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(pub)
+}
+
+// Decode decodes a public key encoded with Encode.
+func Decode(s string) (ed25519.PublicKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	return ed25519.PublicKey(b), nil
+}
@@ -0,0 +1,78 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
+)
+
+func TestSign(t *testing.T) {
+	key, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	payload := []byte("payload")
+	sig := Sign(key, "game", 7, payload)
+	if err := Verify(pub, "game", 7, payload, sig); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	tests := []struct {
+		name    string
+		pub     ed25519.PublicKey
+		gameID  string
+		seq     uint64
+		payload []byte
+	}{
+		{"other player", other.Public().(ed25519.PublicKey), "game", 7, payload},
+		{"other game", pub, "other", 7, payload},
+		{"other sequence number", pub, "game", 8, payload},
+		{"other payload", pub, "game", 7, []byte("other")},
+		{"short key", pub[:8], "game", 7, payload},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.pub, tt.gameID, tt.seq, tt.payload, sig); err != ErrInvalidSignature {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestNewDeterministic(t *testing.T) {
+	k1, err := New(tiwerand.NewDeterministic([]byte("seed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := New(tiwerand.NewDeterministic([]byte("seed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k1, k2) {
+		t.Errorf("identities from the same seed differ")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	key, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	got, err := Decode(Encode(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pub) {
+		t.Errorf("Decode(Encode(%x)) = %x", pub, got)
+	}
+	for _, s := range []string{"", "not base64!", Encode(pub[:16])} {
+		if _, err := Decode(s); err != ErrInvalidPublicKey {
+			t.Errorf("Decode(%q): got error %v, want %v", s, err, ErrInvalidPublicKey)
+		}
+	}
+}
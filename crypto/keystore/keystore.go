@@ -0,0 +1,158 @@
+// Package keystore stores the SRA keys of active games in files encrypted with
+// a passphrase, such that a player can restart after a crash and still decrypt
+// the tiles they sealed.
+//
+// Keys are never written in clear. Files are encrypted with
+// XChaCha20-Poly1305, using a key derived from the passphrase with Argon2id.
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrDecrypt is returned when a keystore cannot be decrypted, because the
+// passphrase is wrong or the data is corrupted.
+var ErrDecrypt = errors.New("keystore: wrong passphrase or corrupted data")
+
+// magic identifies keystore files and the version of their format.
+const magic = "tiwe-keystore-v1"
+
+const saltSize = 16
+
+// kdf holds the parameters of Argon2id.
+type kdf struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+}
+
+// defaultKDF follows the recommendations of the argon2 package.
+var defaultKDF = kdf{Time: 1, Memory: 64 * 1024, Threads: 4}
+
+// Limits of the parameters read from a file, such that a corrupted or tampered
+// file cannot make Open run for too long or use too much memory.
+const (
+	maxTime   = 16
+	maxMemory = 4 * 1024 * 1024 // in KiB
+)
+
+// A Game holds the keys used by a player in a game.
+type Game struct {
+	// ID identifies the game.
+	ID string
+	// Master is the secret from which keys are derived, see sra.DeriveKey.
+	Master []byte
+	// Keys maps a label (e.g., "initial" or "tile/42") to a key.
+	Keys map[string]*sra.Key
+}
+
+// Seal encrypts g with passphrase.
+func Seal(passphrase []byte, g *Game) ([]byte, error) {
+	plaintext, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, len(magic)+9+saltSize+chacha20poly1305.NonceSizeX)
+	header = append(header, magic...)
+	var params [9]byte
+	binary.BigEndian.PutUint32(params[0:], defaultKDF.Time)
+	binary.BigEndian.PutUint32(params[4:], defaultKDF.Memory)
+	params[8] = defaultKDF.Threads
+	header = append(header, params[:]...)
+	random := make([]byte, saltSize+chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, err
+	}
+	header = append(header, random...)
+	salt, nonce := random[:saltSize], random[saltSize:]
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt, defaultKDF))
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// Open decrypts data sealed with Seal.
+func Open(passphrase []byte, data []byte) (*Game, error) {
+	headerSize := len(magic) + 9 + saltSize + chacha20poly1305.NonceSizeX
+	if len(data) < headerSize || !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, fmt.Errorf("keystore: unknown format")
+	}
+	header, ciphertext := data[:headerSize], data[headerSize:]
+	params := header[len(magic):]
+	k := kdf{
+		Time:    binary.BigEndian.Uint32(params[0:]),
+		Memory:  binary.BigEndian.Uint32(params[4:]),
+		Threads: params[8],
+	}
+	if k.Time == 0 || k.Time > maxTime || k.Threads == 0 || k.Memory > maxMemory {
+		return nil, fmt.Errorf("keystore: invalid key derivation parameters")
+	}
+	salt := params[9 : 9+saltSize]
+	nonce := params[9+saltSize:]
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt, k))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	var g Game
+	if err := json.Unmarshal(plaintext, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func deriveKey(passphrase, salt []byte, k kdf) []byte {
+	return argon2.IDKey(passphrase, salt, k.Time, k.Memory, k.Threads, chacha20poly1305.KeySize)
+}
+
+// Save encrypts g with passphrase and writes it to the named file, replacing
+// it atomically if it already exists. The file is only readable by its owner.
+func Save(path string, passphrase []byte, g *Game) error {
+	data, err := Seal(passphrase, g)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads the named file and decrypts it with passphrase.
+func Load(path string, passphrase []byte) (*Game, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Open(passphrase, data)
+}
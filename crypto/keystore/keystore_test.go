@@ -0,0 +1,127 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+)
+
+func init() {
+	// Make tests fast. Real keystores use defaultKDF.
+	defaultKDF = kdf{Time: 1, Memory: 64, Threads: 1}
+}
+
+func TestSealOpen(t *testing.T) {
+	g := testGame(t)
+	passphrase := []byte("correct horse battery staple")
+	data, err := Seal(passphrase, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, g.Master) {
+		t.Fatalf("sealed data contains master secret in clear")
+	}
+	for _, key := range g.Keys {
+		b, _ := key.MarshalBinary()
+		if bytes.Contains(data, b) || bytes.Contains(data, key.K.Bytes()) {
+			t.Fatalf("sealed data contains key in clear")
+		}
+	}
+	got, err := Open(passphrase, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGame(t, got, g)
+
+	if _, err := Open([]byte("wrong"), data); err != ErrDecrypt {
+		t.Errorf("wrong passphrase: got error %v, want %v", err, ErrDecrypt)
+	}
+	data[len(data)-1] ^= 1
+	if _, err := Open(passphrase, data); err != ErrDecrypt {
+		t.Errorf("corrupted data: got error %v, want %v", err, ErrDecrypt)
+	}
+	if _, err := Open(passphrase, data[:10]); err == nil {
+		t.Errorf("truncated data: got nil error")
+	}
+	// The time parameter follows the magic string.
+	data[len(magic)] = 0xff
+	if _, err := Open(passphrase, data); err == nil || err == ErrDecrypt {
+		t.Errorf("excessive time parameter: got error %v, want invalid parameters", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "game.keys")
+	passphrase := []byte("secret")
+	g := testGame(t)
+	// Saving twice replaces the file.
+	for i := 0; i < 2; i++ {
+		if err := Save(path, passphrase, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("file permissions = %v, want readable only by owner", perm)
+	}
+	got, err := Load(path, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGame(t, got, g)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files, want 1", len(files))
+	}
+}
+
+func testGame(t *testing.T) *Game {
+	t.Helper()
+	g := &Game{
+		ID:     "Sunday Fun",
+		Master: bytes.Repeat([]byte{1}, sra.MasterSize),
+		Keys:   make(map[string]*sra.Key),
+	}
+	for _, label := range []string{"initial", "tile/0", "tile/1"} {
+		key, err := sra.GenerateKeyWithParams(rand.Reader, sra.MODP1024.RestrictToSubgroup())
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Keys[label] = key
+	}
+	return g
+}
+
+func checkGame(t *testing.T, got, want *Game) {
+	t.Helper()
+	if got.ID != want.ID {
+		t.Errorf("ID = %q, want %q", got.ID, want.ID)
+	}
+	if !bytes.Equal(got.Master, want.Master) {
+		t.Errorf("Master = %x, want %x", got.Master, want.Master)
+	}
+	if len(got.Keys) != len(want.Keys) {
+		t.Fatalf("got %d keys, want %d", len(got.Keys), len(want.Keys))
+	}
+	for label, key := range want.Keys {
+		if got.Keys[label] == nil || got.Keys[label].Fingerprint() != key.Fingerprint() {
+			t.Errorf("key %q does not match", label)
+		}
+	}
+}
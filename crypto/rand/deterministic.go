@@ -0,0 +1,69 @@
+package rand
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// NewDeterministic returns a new Rand whose output is entirely determined by
+// seed, such that a simulated game or a failing test can be replayed exactly
+// from a logged seed. Values are read from the BLAKE2b XOF of seed.
+//
+// The returned Rand implements io.Reader and can be used wherever a random
+// source is expected, e.g., sra.GenerateKeyWithParams. Its methods other than
+// Read are safe for concurrent use, but the sequence seen by each goroutine
+// then depends on scheduling.
+//
+// The output is predictable to anyone who knows seed, and must never be used
+// to generate the keys or secrets of a real game.
+func NewDeterministic(seed []byte) *rand.Rand {
+	s := &xofSource{}
+	s.reset(seed)
+	return rand.New(s)
+}
+
+// xofSource implements math/rand.Source64 reading from a BLAKE2b XOF.
+type xofSource struct {
+	mu  sync.Mutex
+	xof blake2b.XOF
+	buf [8]byte
+}
+
+// reset restarts the stream of values from seed.
+func (s *xofSource) reset(seed []byte) {
+	xof, err := blake2b.NewXOF(blake2b.OutputLengthUnknown, nil)
+	if err != nil {
+		panic(err)
+	}
+	xof.Write([]byte("tiwe/rand deterministic\x00"))
+	xof.Write(seed)
+	s.xof = xof
+}
+
+// Seed restarts the stream of values as if s was created by NewDeterministic
+// with the 8-byte big-endian encoding of seed.
+func (s *xofSource) Seed(seed int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(seed))
+	s.mu.Lock()
+	s.reset(b[:])
+	s.mu.Unlock()
+}
+
+func (s *xofSource) Int63() int64 {
+	// &^ (1 << 63) clears the sign bit
+	return int64(s.Uint64() &^ (1 << 63))
+}
+
+func (s *xofSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The XOF only fails after producing 256 GiB of output.
+	if _, err := s.xof.Read(s.buf[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint64(s.buf[:])
+}
@@ -0,0 +1,44 @@
+package rand
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	const N = 100
+	r1 := NewDeterministic([]byte("seed"))
+	r2 := NewDeterministic([]byte("seed"))
+	other := NewDeterministic([]byte("other seed"))
+	same := 0
+	for i := 0; i < N; i++ {
+		v1, v2, v3 := r1.Uint64(), r2.Uint64(), other.Uint64()
+		if v1 != v2 {
+			t.Fatalf("values differ with the same seed after %d iterations: %d != %d", i, v1, v2)
+		}
+		if v1 == v3 {
+			same++
+		}
+	}
+	if same == N {
+		t.Errorf("same values with different seeds")
+	}
+	b1, b2 := make([]byte, 100), make([]byte, 100)
+	r1.Read(b1)
+	r2.Read(b2)
+	if !bytes.Equal(b1, b2) {
+		t.Errorf("Read differs with the same seed: %x != %x", b1, b2)
+	}
+}
+
+func TestDeterministicSeed(t *testing.T) {
+	r := NewDeterministic(nil)
+	r.Seed(42)
+	want := NewDeterministic([]byte{0, 0, 0, 0, 0, 0, 0, 42}).Int63()
+	if got := r.Int63(); got != want {
+		t.Errorf("after Seed(42): got %d, want %d", got, want)
+	}
+	if v := r.Int63(); v < 0 {
+		t.Errorf("Int63() = %d, want non-negative", v)
+	}
+}
@@ -3,26 +3,101 @@ package rand
 import (
 	cryptorand "crypto/rand"
 	"encoding/binary"
+	"fmt"
+	"io"
 	"math/rand"
+	"sync"
 )
 
-var source rand.Source64 = cryptoRandSource{}
+// BufferSize is the number of bytes a Source reads at a time from its
+// underlying reader.
+const BufferSize = 4096
 
-// cryptoRandSource implements math/rand.Source64 backed by crypto/rand.
-type cryptoRandSource struct{}
+var source rand.Source64 = NewSource(cryptorand.Reader)
 
-func (cryptoRandSource) Seed(int64) {}
+// A Source implements math/rand.Source64 and io.Reader, reading from an
+// underlying io.Reader in chunks of BufferSize bytes. It is safe for concurrent
+// use by multiple goroutines.
+//
+// Once reading from the underlying reader fails, all methods of the Source
+// fail with the same error: Read returns it, while Uint64 and Int63 panic,
+// unless the Source was created with NewCheckedSource.
+type Source struct {
+	mu      sync.Mutex
+	r       io.Reader
+	buf     [BufferSize]byte
+	pos     int // buf[pos:] has not been used yet
+	err     error
+	checked bool
+}
+
+// NewSource returns a new Source reading from r, typically crypto/rand.Reader.
+// Other readers allow injecting faults in tests.
+func NewSource(r io.Reader) *Source {
+	return &Source{r: r, pos: BufferSize}
+}
 
-func (r cryptoRandSource) Int63() int64 {
+// NewCheckedSource is like NewSource, but the returned Source does not panic if
+// reading from r fails. Instead, Uint64 and Int63 return zero, such that
+// functions like rand.Perm run to completion with meaningless results, and the
+// error is reported by Err. Callers must check Err before using any value
+// obtained from the Source.
+func NewCheckedSource(r io.Reader) *Source {
+	s := NewSource(r)
+	s.checked = true
+	return s
+}
+
+// Err returns the error that caused reading from the underlying reader to
+// fail, if any.
+func (s *Source) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Seed is a no-op, a Source cannot be seeded.
+func (s *Source) Seed(int64) {}
+
+func (s *Source) Int63() int64 {
 	// &^ (1 << 63) clears the sign bit
-	return int64(r.Uint64() &^ (1 << 63))
+	return int64(s.Uint64() &^ (1 << 63))
 }
 
-func (cryptoRandSource) Uint64() uint64 {
+func (s *Source) Uint64() uint64 {
 	var b [8]byte
-	_, err := cryptorand.Read(b[:])
-	if err != nil {
+	if _, err := s.Read(b[:]); err != nil {
+		if s.checked {
+			return 0
+		}
 		panic(err)
 	}
 	return binary.BigEndian.Uint64(b[:])
 }
+
+// Read fills p with random bytes. It returns an error only if reading from the
+// underlying reader failed, in which case the contents of p are undefined.
+func (s *Source) Read(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n < len(p) {
+		if s.err != nil {
+			return n, s.err
+		}
+		if s.pos == len(s.buf) {
+			if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+				s.err = fmt.Errorf("rand: cannot read random bytes: %w", err)
+				continue
+			}
+			s.pos = 0
+		}
+		m := copy(p[n:], s.buf[s.pos:])
+		// Bytes are never returned twice.
+		for i := s.pos; i < s.pos+m; i++ {
+			s.buf[i] = 0
+		}
+		s.pos += m
+		n += m
+	}
+	return n, nil
+}
@@ -1,7 +1,13 @@
 package rand
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -44,3 +50,82 @@ func TestSourceUint64(t *testing.T) {
 		t.Errorf("bits = %064b, want all bits set", bits)
 	}
 }
+
+// countingReader counts the calls to Read of the underlying reader.
+type countingReader struct {
+	r     io.Reader
+	calls int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.calls++
+	return r.r.Read(p)
+}
+
+func TestSourceBuffered(t *testing.T) {
+	r := &countingReader{r: iotest.OneByteReader(NewDeterministic(nil))}
+	s := NewSource(r)
+	want := make([]byte, 3*BufferSize/2)
+	if _, err := io.ReadFull(NewDeterministic(nil), want); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(want))
+	for i := 0; i < len(got); i += 8 {
+		binary.BigEndian.PutUint64(got[i:], s.Uint64())
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got bytes different from the underlying reader")
+	}
+	if want := 2 * BufferSize; r.calls != want {
+		t.Errorf("underlying reader called %d times, want %d", r.calls, want)
+	}
+}
+
+// errReader returns err after n bytes.
+type errReader struct {
+	n   int
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestSourceError(t *testing.T) {
+	errBroken := errors.New("broken")
+
+	s := NewSource(&errReader{n: BufferSize, err: errBroken})
+	p := make([]byte, BufferSize)
+	if _, err := s.Read(p); err != nil {
+		t.Fatalf("Read before failure: %v", err)
+	}
+	if _, err := s.Read(p[:1]); !errors.Is(err, errBroken) {
+		t.Fatalf("Read: got error %v, want %v", err, errBroken)
+	}
+	if !errors.Is(s.Err(), errBroken) {
+		t.Errorf("Err() = %v, want %v", s.Err(), errBroken)
+	}
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, errBroken) {
+				t.Errorf("Uint64: got panic %v, want %v", err, errBroken)
+			}
+		}()
+		s.Uint64()
+	}()
+
+	s = NewCheckedSource(&errReader{err: errBroken})
+	if perm := rand.New(s).Perm(10); len(perm) != 10 {
+		t.Errorf("Perm(10) = %v, want 10 values", perm)
+	}
+	if !errors.Is(s.Err(), errBroken) {
+		t.Errorf("checked source: Err() = %v, want %v", s.Err(), errBroken)
+	}
+}
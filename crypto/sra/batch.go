@@ -0,0 +1,103 @@
+package sra
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+)
+
+// EncryptBatch encrypts every plaintext with k, concurrently using up to
+// GOMAXPROCS goroutines. It returns the first error encountered, or the error
+// of ctx if it is canceled before all plaintexts are encrypted.
+func (k *Key) EncryptBatch(ctx context.Context, plaintexts [][]byte) ([][]byte, error) {
+	return batch(ctx, plaintexts, func(i int, b []byte) ([]byte, error) {
+		return k.Encrypt(b)
+	})
+}
+
+// DecryptBatch decrypts every ciphertext with k, concurrently using up to
+// GOMAXPROCS goroutines. It returns the first error encountered, or the error
+// of ctx if it is canceled before all ciphertexts are decrypted.
+func (k *Key) DecryptBatch(ctx context.Context, ciphertexts [][]byte) ([][]byte, error) {
+	return batch(ctx, ciphertexts, func(i int, b []byte) ([]byte, error) {
+		return k.Decrypt(b)
+	})
+}
+
+// EncryptEach is like EncryptBatch, but encrypts plaintexts[i] with keys[i].
+// It is useful to encrypt each tile with a tile-specific key. Keys may be of any
+// commutative scheme.
+func EncryptEach(ctx context.Context, keys []commutative.Key, plaintexts [][]byte) ([][]byte, error) {
+	if len(keys) != len(plaintexts) {
+		return nil, errMismatchedKeys(len(keys), len(plaintexts))
+	}
+	return batch(ctx, plaintexts, func(i int, b []byte) ([]byte, error) {
+		return keys[i].Encrypt(b)
+	})
+}
+
+// DecryptEach is like DecryptBatch, but decrypts ciphertexts[i] with keys[i].
+func DecryptEach(ctx context.Context, keys []commutative.Key, ciphertexts [][]byte) ([][]byte, error) {
+	if len(keys) != len(ciphertexts) {
+		return nil, errMismatchedKeys(len(keys), len(ciphertexts))
+	}
+	return batch(ctx, ciphertexts, func(i int, b []byte) ([]byte, error) {
+		return keys[i].Decrypt(b)
+	})
+}
+
+func errMismatchedKeys(nkeys, nvalues int) error {
+	return fmt.Errorf("sra: got %d keys for %d values", nkeys, nvalues)
+}
+
+// batch calls fn for every element of in, concurrently using up to GOMAXPROCS
+// goroutines, and returns the results in the same order as in.
+func batch(ctx context.Context, in [][]byte, fn func(i int, b []byte) ([]byte, error)) ([][]byte, error) {
+	out := make([][]byte, len(in))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(in) {
+		workers = len(in)
+	}
+	var (
+		next     int64 = -1
+		failed   int32
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		atomic.StoreInt32(&failed, 1)
+	}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(in) {
+					return
+				}
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+				b, err := fn(i, in[i])
+				if err != nil {
+					fail(fmt.Errorf("item %d: %w", i, err))
+					return
+				}
+				out[i] = b
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
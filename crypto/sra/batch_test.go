@@ -0,0 +1,132 @@
+package sra
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+)
+
+func TestBatch(t *testing.T) {
+	params := MODP1024.RestrictToSubgroup()
+	key := generateKey(t, params)
+	plaintexts := testPlaintexts(t, params, 50)
+	ctx := context.Background()
+	ciphertexts, err := key.EncryptBatch(ctx, plaintexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range ciphertexts {
+		if want := encrypt(t, key, plaintexts[i]); !eq(c, want) {
+			t.Fatalf("item %d: got %x, want %x", i, c, want)
+		}
+	}
+	recovered, err := key.DecryptBatch(ctx, ciphertexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range recovered {
+		if !eq(p, plaintexts[i]) {
+			t.Fatalf("item %d: got %x, want %x", i, p, plaintexts[i])
+		}
+	}
+}
+
+func TestBatchEach(t *testing.T) {
+	params := MODP1024.RestrictToSubgroup()
+	plaintexts := testPlaintexts(t, params, 20)
+	keys := make([]*Key, len(plaintexts))
+	each := make([]commutative.Key, len(plaintexts))
+	for i := range keys {
+		keys[i] = generateKey(t, params)
+		each[i] = keys[i]
+	}
+	ctx := context.Background()
+	ciphertexts, err := EncryptEach(ctx, each, plaintexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range ciphertexts {
+		if want := encrypt(t, keys[i], plaintexts[i]); !eq(c, want) {
+			t.Fatalf("item %d: got %x, want %x", i, c, want)
+		}
+	}
+	recovered, err := DecryptEach(ctx, each, ciphertexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range recovered {
+		if !eq(p, plaintexts[i]) {
+			t.Fatalf("item %d: got %x, want %x", i, p, plaintexts[i])
+		}
+	}
+	if _, err := EncryptEach(ctx, each[1:], plaintexts); err == nil {
+		t.Errorf("got nil error for mismatched keys")
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	key := generateKey(t, MODP1024)
+	ciphertexts := [][]byte{{1}, {2}, {0}, {3}}
+	_, err := key.DecryptBatch(context.Background(), ciphertexts)
+	if !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidCiphertext)
+	}
+	if got, want := err.Error(), "item 2: "+ErrInvalidCiphertext.Error(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBatchCanceled(t *testing.T) {
+	key := generateKey(t, MODP1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := key.EncryptBatch(ctx, [][]byte{{1}, {2}, {3}})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func testPlaintexts(t testing.TB, params *Params, n int) [][]byte {
+	t.Helper()
+	plaintexts := make([][]byte, n)
+	for i := range plaintexts {
+		p, err := params.MapToSubgroup([]byte(strconv.Itoa(i + 2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintexts[i] = p
+	}
+	return plaintexts
+}
+
+// BenchmarkDeck compares encrypting and decrypting a deck of 106 tiles one at
+// a time and in batch.
+func BenchmarkDeck(b *testing.B) {
+	ctx := context.Background()
+	for _, params := range []*Params{MODP1024, MODP2048, P256} {
+		params := params.RestrictToSubgroup()
+		key := generateKey(b, params)
+		deck := testPlaintexts(b, params, 106)
+		b.Run(params.Name+"/Sequential", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, p := range deck {
+					decrypt(b, key, encrypt(b, key, p))
+				}
+			}
+		})
+		b.Run(params.Name+"/Batch", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c, err := key.EncryptBatch(ctx, deck)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := key.DecryptBatch(ctx, c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
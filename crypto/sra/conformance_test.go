@@ -0,0 +1,26 @@
+package sra_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+	"github.com/rhcarvalho/tiwe/crypto/commutative/commutativetest"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game/tilecode"
+)
+
+func TestConformance(t *testing.T) {
+	for _, params := range []*sra.Params{sra.MODP1024, sra.MODP1024.RestrictToSubgroup(), sra.P256} {
+		params := params
+		t.Run(params.Name, func(t *testing.T) {
+			commutativetest.Run(t, commutativetest.Backend{
+				NewKey: func() (commutative.Key, error) {
+					return sra.GenerateKeyWithParams(rand.Reader, params)
+				},
+				Codec:   tilecode.New(params),
+				Invalid: []byte{0},
+			})
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package sra
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// ctWindow is the number of exponent bits processed at a time by ctExp.
+const ctWindow = 4
+
+// ctExp returns x^e mod n, for an odd n and 0 <= x < n, using a fixed-window
+// exponentiation with Montgomery multiplication over fixed-size limbs.
+//
+// Unlike big.Int.Exp, the sequence of operations and memory accesses does not
+// depend on the value of e or x: every window of the exponent costs the same
+// squarings and one multiplication by a table entry selected in constant
+// time, and the exponent is always processed over expBitLen bits, typically
+// the bit length of the group order. It must be used with secret exponents,
+// since the timing of responses is observable by other players.
+func ctExp(x, e, n *big.Int, expBitLen int) *big.Int {
+	if e.BitLen() > expBitLen {
+		// Only malformed keys have exponents larger than the group
+		// order, leaking their size is harmless.
+		expBitLen = e.BitLen()
+	}
+	expLen := (expBitLen + 7) / 8
+	exp := e.FillBytes(make([]byte, expLen))
+
+	mt := newMontgomery(n)
+	size := len(mt.m)
+	xm := make([]uint64, size)
+	mt.mul(xm, toLimbs(x, size), mt.rr)
+
+	// table[i] = x^i in Montgomery form.
+	var table [1 << ctWindow][]uint64
+	table[0] = mt.one()
+	for i := 1; i < len(table); i++ {
+		table[i] = make([]uint64, size)
+		mt.mul(table[i], table[i-1], xm)
+	}
+
+	acc := mt.one()
+	sel := make([]uint64, size)
+	for _, b := range exp {
+		for _, w := range []byte{b >> 4, b & 0xf} {
+			for i := 0; i < ctWindow; i++ {
+				mt.mul(acc, acc, acc)
+			}
+			for j := range sel {
+				sel[j] = 0
+			}
+			for i, t := range table {
+				mask := -uint64(subtle.ConstantTimeByteEq(byte(i), w))
+				for j := range sel {
+					sel[j] |= t[j] & mask
+				}
+			}
+			mt.mul(acc, acc, sel)
+		}
+	}
+
+	// Convert out of Montgomery form multiplying by 1.
+	one := make([]uint64, size)
+	one[0] = 1
+	mt.mul(acc, acc, one)
+	return fromLimbs(acc)
+}
+
+// montgomery holds the precomputed values for arithmetic modulo an odd m in
+// Montgomery form, with R = 2^(64*len(m)).
+type montgomery struct {
+	m     []uint64 // little-endian limbs of the modulus
+	m0inv uint64   // -m^-1 mod 2^64
+	rr    []uint64 // R^2 mod m
+	t     []uint64 // scratch space for mul
+}
+
+func newMontgomery(n *big.Int) *montgomery {
+	size := (n.BitLen() + 63) / 64
+	mt := &montgomery{m: toLimbs(n, size), t: make([]uint64, size+2)}
+	// Newton's iteration doubles the number of correct low bits of the
+	// inverse in each step, starting with 3 bits since m*m ≡ 1 (mod 8).
+	inv := mt.m[0]
+	for i := 0; i < 5; i++ {
+		inv *= 2 - mt.m[0]*inv
+	}
+	mt.m0inv = -inv
+	rr := new(big.Int).Lsh(bigOne, uint(128*size))
+	mt.rr = toLimbs(rr.Mod(rr, n), size)
+	return mt
+}
+
+// one returns R mod m, the Montgomery form of 1.
+func (mt *montgomery) one() []uint64 {
+	z := make([]uint64, len(mt.m))
+	one := make([]uint64, len(mt.m))
+	one[0] = 1
+	mt.mul(z, one, mt.rr)
+	return z
+}
+
+// mul sets z = x*y/R mod m, with the Coarsely Integrated Operand Scanning
+// method. z may alias x or y.
+func (mt *montgomery) mul(z, x, y []uint64) {
+	n := len(mt.m)
+	t := mt.t
+	for j := range t {
+		t[j] = 0
+	}
+	for i := 0; i < n; i++ {
+		// t += x * y[i]
+		var c, cc uint64
+		for j := 0; j < n; j++ {
+			hi, lo := bits.Mul64(x[j], y[i])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t[n], cc = bits.Add64(t[n], c, 0)
+		t[n+1] = cc
+
+		// t = (t + u*m) / 2^64, where u is chosen such that the
+		// lowest limb becomes zero.
+		u := t[0] * mt.m0inv
+		hi, lo := bits.Mul64(u, mt.m[0])
+		_, cc = bits.Add64(lo, t[0], 0)
+		c = hi + cc
+		for j := 1; j < n; j++ {
+			hi, lo = bits.Mul64(u, mt.m[j])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[n-1], cc = bits.Add64(t[n], c, 0)
+		t[n] = t[n+1] + cc
+	}
+
+	// t < 2m, subtract m if t >= m without branching on the result.
+	var b uint64
+	for j := 0; j < n; j++ {
+		z[j], b = bits.Sub64(t[j], mt.m[j], b)
+	}
+	_, b = bits.Sub64(t[n], 0, b)
+	// b is 1 if t < m, in which case t is kept.
+	mask := -b
+	for j := 0; j < n; j++ {
+		z[j] = t[j]&mask | z[j]&^mask
+	}
+}
+
+// toLimbs returns x as size little-endian 64-bit limbs.
+func toLimbs(x *big.Int, size int) []uint64 {
+	buf := x.FillBytes(make([]byte, 8*size))
+	z := make([]uint64, size)
+	for i := range z {
+		z[i] = binary.BigEndian.Uint64(buf[len(buf)-8*(i+1):])
+	}
+	return z
+}
+
+// fromLimbs is the inverse of toLimbs.
+func fromLimbs(z []uint64) *big.Int {
+	buf := make([]byte, 8*len(z))
+	for i, w := range z {
+		binary.BigEndian.PutUint64(buf[len(buf)-8*(i+1):], w)
+	}
+	return new(big.Int).SetBytes(buf)
+}
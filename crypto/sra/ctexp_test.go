@@ -0,0 +1,97 @@
+package sra
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestCtExp(t *testing.T) {
+	moduli := []*big.Int{
+		big.NewInt(3),
+		big.NewInt(1<<61 - 1),
+		new(big.Int).Sub(new(big.Int).Lsh(bigOne, 64), big.NewInt(59)),
+		new(big.Int).Add(new(big.Int).Lsh(bigOne, 64), big.NewInt(13)),
+		MODP1024.N,
+		MODP2048Q256.N,
+		MODP2048.N,
+	}
+	for _, n := range moduli {
+		order := new(big.Int).Sub(n, bigOne)
+		bases := []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(2), order}
+		exps := []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(2), big.NewInt(15), big.NewInt(16), order}
+		for i := 0; i < 3; i++ {
+			x, err := rand.Int(rand.Reader, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := rand.Int(rand.Reader, order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bases = append(bases, x)
+			exps = append(exps, e)
+		}
+		for _, x := range bases {
+			for _, e := range exps {
+				want := new(big.Int).Exp(x, e, n)
+				if got := ctExp(x, e, n, order.BitLen()); got.Cmp(want) != 0 {
+					t.Fatalf("ctExp(%v, %v, %v) = %v, want %v", x, e, n, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCtExpLargeExponent(t *testing.T) {
+	// Exponents larger than expBitLen are still computed correctly.
+	n := MODP1024.N
+	x := big.NewInt(5)
+	e := new(big.Int).Lsh(bigOne, 300)
+	want := new(big.Int).Exp(x, e, n)
+	if got := ctExp(x, e, n, 160); got.Cmp(want) != 0 {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncryptMatchesExp(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP1024.RestrictToSubgroup(), MODP2048} {
+		key := generateKey(t, params)
+		m, err := params.MapToSubgroup([]byte{42})
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := new(big.Int).SetBytes(m)
+		want := new(big.Int).Exp(x, key.K, key.N).Bytes()
+		c := encrypt(t, key, m)
+		if !eq(c, want) {
+			t.Errorf("%s: Encrypt = %x, want %x", params.Name, c, want)
+		}
+		want = new(big.Int).Exp(x, key.L, key.N).Bytes()
+		if got := decrypt(t, key, m); !eq(got, want) {
+			t.Errorf("%s: Decrypt = %x, want %x", params.Name, got, want)
+		}
+	}
+}
+
+func BenchmarkExp(b *testing.B) {
+	for _, params := range []*Params{MODP1024.RestrictToSubgroup(), MODP2048Q256.RestrictToSubgroup(), MODP2048} {
+		key := generateKey(b, params)
+		x, err := params.MapToSubgroup([]byte{42})
+		if err != nil {
+			b.Fatal(err)
+		}
+		m := new(big.Int).SetBytes(x)
+		bitLen := params.exponentBitLen()
+		b.Run(params.Name+"/big.Int", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				new(big.Int).Exp(m, key.L, key.N)
+			}
+		})
+		b.Run(params.Name+"/ConstantTime", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctExp(m, key.L, key.N, bitLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package sra
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrNotOnCurve is returned for elliptic curve Params when a plaintext or a
+// ciphertext is not the compressed encoding of a point on the curve.
+var ErrNotOnCurve = errors.New("sra: value is not a point on the curve")
+
+// P256 are the parameters of the commutative scheme on the NIST P-256 curve,
+// where encryption is scalar multiplication of a point by K. Points are
+// encoded in compressed form in 33 bytes, much smaller than MODP values, and
+// scalar multiplication is much faster than modular exponentiation. Since the
+// group of points has prime order, P256 is always in subgroup mode.
+var P256 = curveParams("P-256", elliptic.P256())
+
+func curveParams(name string, curve elliptic.Curve) *Params {
+	cp := curve.Params()
+	return &Params{
+		Name:      name,
+		N:         cp.P,
+		Q:         cp.N,
+		ExpBitLen: cp.BitSize,
+		Subgroup:  true,
+		Curve:     curve,
+	}
+}
+
+// checkPoint returns ErrNotOnCurve if b is not the compressed encoding of a
+// point on the curve of p.
+func (p *Params) checkPoint(b []byte) error {
+	if x, _ := elliptic.UnmarshalCompressed(p.Curve, b); x == nil {
+		return ErrNotOnCurve
+	}
+	return nil
+}
+
+// hashToCurve maps x to a point on the curve of p, hashing x together with a
+// counter with BLAKE2b-256 until the digest is the X coordinate of a point
+// (try-and-increment). The mapping is not constant time, and must only be
+// used for public values such as tile encodings.
+func (p *Params) hashToCurve(x []byte) []byte {
+	cp := p.Curve.Params()
+	for ctr := 0; ; ctr++ {
+		h, _ := blake2b.New256(nil)
+		h.Write([]byte("tiwe/sra hash to curve\x00"))
+		writeBytes(h, []byte(cp.Name))
+		writeBytes(h, x)
+		h.Write([]byte{byte(ctr >> 8), byte(ctr)})
+		px := new(big.Int).SetBytes(h.Sum(nil))
+		if px.Cmp(cp.P) >= 0 {
+			continue
+		}
+		// y² = x³ - 3x + b
+		y2 := new(big.Int).Exp(px, big.NewInt(3), cp.P)
+		t := new(big.Int).Lsh(px, 1)
+		t.Add(t, px)
+		y2.Sub(y2, t)
+		y2.Add(y2, cp.B)
+		y2.Mod(y2, cp.P)
+		py := new(big.Int).ModSqrt(y2, cp.P)
+		if py == nil {
+			continue
+		}
+		return elliptic.MarshalCompressed(p.Curve, px, py)
+	}
+}
+
+// curveExp returns the point encoded in b multiplied by the scalar e. The
+// point must be valid, see checkPoint.
+func (p *Params) curveExp(b []byte, e *big.Int) []byte {
+	x, y := elliptic.UnmarshalCompressed(p.Curve, b)
+	x, y = p.Curve.ScalarMult(x, y, e.Bytes())
+	return elliptic.MarshalCompressed(p.Curve, x, y)
+}
+
+// curveMul returns the sum of the points encoded in a and b. The points must be
+// valid, see checkPoint.
+func (p *Params) curveMul(a, b []byte) []byte {
+	x1, y1 := elliptic.UnmarshalCompressed(p.Curve, a)
+	x2, y2 := elliptic.UnmarshalCompressed(p.Curve, b)
+	x, y := p.Curve.Add(x1, y1, x2, y2)
+	return elliptic.MarshalCompressed(p.Curve, x, y)
+}
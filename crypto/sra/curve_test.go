@@ -0,0 +1,84 @@
+package sra
+
+import (
+	"crypto/elliptic"
+	"strconv"
+	"testing"
+)
+
+func TestCurve(t *testing.T) {
+	params := P256
+	keys := []*Key{generateKey(t, params), generateKey(t, params), generateKey(t, params)}
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		plaintext, err := params.MapToSubgroup([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := params.MapToSubgroup([]byte(strconv.Itoa(i))); !eq(again, plaintext) {
+			t.Fatalf("MapToSubgroup(%d) is not deterministic", i)
+		}
+		if seen[string(plaintext)] {
+			t.Fatalf("MapToSubgroup(%d): collision", i)
+		}
+		seen[string(plaintext)] = true
+		if err := params.CheckCiphertext(plaintext); err != nil {
+			t.Fatalf("MapToSubgroup(%d): %v", i, err)
+		}
+		buf := plaintext
+		for _, key := range keys {
+			buf = encrypt(t, key, buf)
+		}
+		if len(buf) != 33 {
+			t.Errorf("ciphertext has %d bytes, want 33", len(buf))
+		}
+		for _, j := range []int{1, 2, 0} {
+			buf = decrypt(t, keys[j], buf)
+		}
+		if !eq(buf, plaintext) {
+			t.Fatalf("not commutative: got %x, want %x", buf, plaintext)
+		}
+	}
+}
+
+func TestCurveInvalid(t *testing.T) {
+	key := generateKey(t, P256)
+	valid, _ := P256.MapToSubgroup([]byte("tile"))
+	uncompressed := elliptic.Marshal(P256.Curve, P256.Curve.Params().Gx, P256.Curve.Params().Gy)
+	badPrefix := dup(valid)
+	badPrefix[0] = 5
+	for _, b := range [][]byte{nil, {0}, valid[1:], badPrefix, uncompressed, MODP1024.G.Bytes()} {
+		if _, err := key.Encrypt(b); err != ErrNotOnCurve {
+			t.Errorf("Encrypt(%x): got error %v, want %v", b, err, ErrNotOnCurve)
+		}
+		if _, err := key.Decrypt(b); err != ErrNotOnCurve {
+			t.Errorf("Decrypt(%x): got error %v, want %v", b, err, ErrNotOnCurve)
+		}
+		if err := P256.CheckCiphertext(b); err != ErrNotOnCurve {
+			t.Errorf("CheckCiphertext(%x): got error %v, want %v", b, err, ErrNotOnCurve)
+		}
+	}
+}
+
+func TestCurveParams(t *testing.T) {
+	if P256.RestrictToSubgroup() != P256 {
+		t.Errorf("RestrictToSubgroup returned a copy")
+	}
+	custom := &Params{N: P256.N, Q: P256.Q, Subgroup: true}
+	if P256.Equal(custom) || P256.ID() == custom.ID() {
+		t.Errorf("P256 is equal to MODP params with the same numbers")
+	}
+	key := generateKey(t, P256)
+	b, err := key.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Key
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Params() != P256 {
+		t.Errorf("Params = %v, want %v", got.group().Name, P256.Name)
+	}
+	checkKeysEqual(t, &got, key)
+}
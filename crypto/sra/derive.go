@@ -0,0 +1,54 @@
+package sra
+
+import (
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// MasterSize is the recommended size in bytes of master secrets used with
+// DeriveKey.
+const MasterSize = 32
+
+// DeriveKey deterministically derives a Key with DefaultParams from a master
+// secret. See DeriveKeyWithParams.
+func DeriveKey(master []byte, gameID string, label string, index int) *Key {
+	return DeriveKeyWithParams(DefaultParams, master, gameID, label, index)
+}
+
+// DeriveKeyWithParams deterministically derives a Key with the given group
+// parameters from a master secret, typically MasterSize random bytes.
+//
+// The same inputs always produce the same key, so that a player only needs to
+// remember the master secret of a game to regenerate their initial key and
+// every tile key (e.g., label "tile" and the tile index), to recover from a
+// crash or to reveal keys for auditing at the end of a game. Keys for distinct
+// game IDs, labels or indexes are independent.
+func DeriveKeyWithParams(params *Params, master []byte, gameID string, label string, index int) *Key {
+	xof, err := blake2b.NewXOF(blake2b.OutputLengthUnknown, nil)
+	if err != nil {
+		panic("sra: " + err.Error())
+	}
+	xof.Write([]byte("tiwe/sra derive\x00"))
+	for _, b := range [][]byte{master, []byte(gameID), []byte(label)} {
+		writeBytes(xof, b)
+	}
+	var i [8]byte
+	binary.BigEndian.PutUint64(i[:], uint64(index))
+	xof.Write(i[:])
+	key, err := GenerateKeyWithParams(xof, params)
+	if err != nil {
+		// The output of the XOF is practically unlimited.
+		panic("sra: " + err.Error())
+	}
+	return key
+}
+
+// writeBytes writes the length-prefixed b to w.
+func writeBytes(w io.Writer, b []byte) {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+	w.Write(l[:])
+	w.Write(b)
+}
@@ -0,0 +1,51 @@
+package sra
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	master := bytes.Repeat([]byte{7}, MasterSize)
+	params := MODP1024.RestrictToSubgroup()
+	key := DeriveKeyWithParams(params, master, "game", "tile", 1)
+	if again := DeriveKeyWithParams(params, master, "game", "tile", 1); again.Fingerprint() != key.Fingerprint() {
+		t.Fatalf("derivation is not deterministic")
+	}
+	if key.Params() != params {
+		t.Errorf("Params = %v, want %v", key.group().Name, params.Name)
+	}
+	plaintext, err := params.MapToSubgroup([]byte{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decrypt(t, key, encrypt(t, key, plaintext)); !eq(got, plaintext) {
+		t.Errorf("got %x, want %x", got, plaintext)
+	}
+
+	others := []*Key{
+		DeriveKeyWithParams(params, bytes.Repeat([]byte{8}, MasterSize), "game", "tile", 1),
+		DeriveKeyWithParams(params, master, "other game", "tile", 1),
+		DeriveKeyWithParams(params, master, "game", "initial", 1),
+		DeriveKeyWithParams(params, master, "game", "tile", 2),
+		// Length prefixes prevent ambiguous concatenations.
+		DeriveKeyWithParams(params, master, "gamet", "ile", 1),
+	}
+	for i, other := range others {
+		if other.Fingerprint() == key.Fingerprint() {
+			t.Errorf("key %d is not independent", i)
+		}
+	}
+}
+
+// TestDeriveKeyStable guards against accidental changes to the derivation,
+// which would make keys from previous versions irrecoverable.
+func TestDeriveKeyStable(t *testing.T) {
+	master := bytes.Repeat([]byte{7}, MasterSize)
+	key := DeriveKey(master, "game", "initial", 0)
+	if got, want := key.K.Text(16), deriveKeyGoldenK; got != want {
+		t.Errorf("K = %s, want %s", got, want)
+	}
+}
+
+const deriveKeyGoldenK = "fe9d44609f53a083524e44dae056e90936844c4287f3519c73f60fff"
@@ -0,0 +1,154 @@
+package sra
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// keyVersion is the version of the binary encoding of keys.
+const keyVersion = 1
+
+// errInvalidKey is returned when decoding a malformed key.
+var errInvalidKey = errors.New("sra: invalid key encoding")
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding contains the
+// secret exponents, and must not be stored or transmitted in clear.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	params := k.group()
+	var flags byte
+	if params.Subgroup {
+		flags |= 1
+	}
+	b := []byte{keyVersion, flags}
+	for _, x := range []*big.Int{params.N, params.Q, k.K, k.L} {
+		b = appendInt(b, x)
+	}
+	return b, nil
+}
+
+// appendInt appends the length-prefixed big-endian bytes of x to b.
+func appendInt(b []byte, x *big.Int) []byte {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(x.Bytes())))
+	b = append(b, l[:]...)
+	return append(b, x.Bytes()...)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (k *Key) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != keyVersion || data[1]&^1 != 0 {
+		return errInvalidKey
+	}
+	subgroup := data[1]&1 == 1
+	data = data[2:]
+	var xs [4]*big.Int
+	for i := range xs {
+		if len(data) < 4 {
+			return errInvalidKey
+		}
+		l := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint32(len(data)) < l {
+			return errInvalidKey
+		}
+		xs[i] = new(big.Int).SetBytes(data[:l])
+		data = data[l:]
+	}
+	if len(data) != 0 {
+		return errInvalidKey
+	}
+	return k.set(xs[0], xs[1], subgroup, xs[2], xs[3])
+}
+
+// set sets k to the given values, after checking their consistency.
+func (k *Key) set(n, q *big.Int, subgroup bool, kk, l *big.Int) error {
+	params := lookupParams(n, q, subgroup)
+	order := params.totient()
+	if subgroup {
+		order = params.Q
+	}
+	if order.Sign() <= 0 || kk.Sign() <= 0 || l.Sign() <= 0 {
+		return errInvalidKey
+	}
+	if x := new(big.Int).Mul(kk, l); x.Mod(x, order).Cmp(bigOne) != 0 {
+		return fmt.Errorf("%w: exponents are not inverses", errInvalidKey)
+	}
+	*k = Key{N: params.N, K: kk, L: l, params: params}
+	return nil
+}
+
+// lookupParams returns built-in Params matching the arguments, or new Params
+// if there is no match.
+func lookupParams(n, q *big.Int, subgroup bool) *Params {
+	params := &Params{Name: "custom", N: n, Q: q, ExpBitLen: minBitLen}
+	for _, builtin := range []*Params{MODP1024, MODP2048Q256, MODP2048, MODP3072, P256} {
+		if builtin.N.Cmp(n) == 0 && builtin.Q.Cmp(q) == 0 {
+			params = builtin
+			break
+		}
+	}
+	if subgroup {
+		params = params.RestrictToSubgroup()
+	}
+	return params
+}
+
+// keyJSON is the JSON representation of a Key. Numbers are hex encoded.
+type keyJSON struct {
+	Params   string `json:"params,omitempty"`
+	N        string `json:"n"`
+	Q        string `json:"q,omitempty"`
+	Subgroup bool   `json:"subgroup,omitempty"`
+	K        string `json:"k"`
+	L        string `json:"l"`
+}
+
+// MarshalJSON implements json.Marshaler. The encoding contains the secret
+// exponents, and must not be stored or transmitted in clear.
+func (k *Key) MarshalJSON() ([]byte, error) {
+	params := k.group()
+	return json.Marshal(keyJSON{
+		Params:   params.Name,
+		N:        params.N.Text(16),
+		Q:        params.Q.Text(16),
+		Subgroup: params.Subgroup,
+		K:        k.K.Text(16),
+		L:        k.L.Text(16),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var v keyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Q == "" {
+		v.Q = "0"
+	}
+	var xs [4]*big.Int
+	for i, s := range []string{v.N, v.Q, v.K, v.L} {
+		x, ok := new(big.Int).SetString(s, 16)
+		if !ok {
+			return errInvalidKey
+		}
+		xs[i] = x
+	}
+	return k.set(xs[0], xs[1], v.Subgroup, xs[2], xs[3])
+}
+
+// Fingerprint returns a short string that identifies k, suitable for display
+// and logs. It does not reveal the secret exponents.
+func (k *Key) Fingerprint() string {
+	b, _ := k.MarshalBinary()
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/sra key\x00"))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
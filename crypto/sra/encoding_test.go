@@ -0,0 +1,101 @@
+package sra
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestKeyMarshalBinary(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048, MODP2048Q256.RestrictToSubgroup(), MODP1024.RestrictToSubgroup()} {
+		t.Run(params.Name, func(t *testing.T) {
+			key := generateKey(t, params)
+			b, err := key.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Key
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			checkKeysEqual(t, &got, key)
+		})
+	}
+}
+
+func TestKeyUnmarshalBinaryInvalid(t *testing.T) {
+	key := generateKey(t, MODP1024)
+	b, err := key.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := dup(b)
+	corrupt[len(corrupt)-1] ^= 1
+	tests := map[string][]byte{
+		"empty":             nil,
+		"unknown version":   append([]byte{keyVersion + 1}, b[1:]...),
+		"unknown flags":     append([]byte{keyVersion, 2}, b[2:]...),
+		"truncated":         b[:len(b)-1],
+		"trailing data":     append(dup(b), 0),
+		"corrupt exponent":  corrupt,
+		"missing exponents": b[:2+4+len(key.N.Bytes())],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got Key
+			if err := got.UnmarshalBinary(data); err == nil {
+				t.Errorf("got nil error")
+			}
+		})
+	}
+}
+
+func TestKeyMarshalJSON(t *testing.T) {
+	for _, params := range []*Params{MODP2048, MODP2048.RestrictToSubgroup()} {
+		t.Run(params.Name, func(t *testing.T) {
+			key := generateKey(t, params)
+			b, err := json.Marshal(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got *Key
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			checkKeysEqual(t, got, key)
+		})
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	key1 := generateKey(t, MODP1024)
+	key2 := generateKey(t, MODP1024)
+	if len(key1.Fingerprint()) != 16 {
+		t.Errorf("got fingerprint %q, want 16 hex digits", key1.Fingerprint())
+	}
+	if key1.Fingerprint() != key1.Fingerprint() {
+		t.Errorf("fingerprint is not deterministic")
+	}
+	if key1.Fingerprint() == key2.Fingerprint() {
+		t.Errorf("different keys have the same fingerprint")
+	}
+}
+
+func checkKeysEqual(t *testing.T, got, want *Key) {
+	t.Helper()
+	if got.N.Cmp(want.N) != 0 || got.K.Cmp(want.K) != 0 || got.L.Cmp(want.L) != 0 {
+		t.Errorf("got key %v, want %v", got.Fingerprint(), want.Fingerprint())
+	}
+	if !got.group().Equal(want.group()) {
+		t.Errorf("got params %v, want %v", got.group().Name, want.group().Name)
+	}
+	if got.group().Name != want.group().Name {
+		t.Errorf("got params name %q, want %q", got.group().Name, want.group().Name)
+	}
+	plaintext := []byte{42}
+	if want.group().Subgroup {
+		plaintext, _ = want.group().MapToSubgroup(plaintext)
+	}
+	if c := encrypt(t, want, plaintext); !eq(decrypt(t, got, c), plaintext) {
+		t.Errorf("decoded key cannot decrypt")
+	}
+}
@@ -0,0 +1,70 @@
+package sra
+
+import (
+	"crypto/elliptic"
+	"io"
+	"math/big"
+)
+
+// The methods below implement operations on encoded group elements, for both
+// MODP and elliptic curve Params. They are written in multiplicative notation:
+// for curves, exp is scalar multiplication and mul is point addition.
+
+// exp returns b^e. b must be a valid element, see CheckCiphertext. The running
+// time depends on e, see expSecret.
+func (p *Params) exp(b []byte, e *big.Int) []byte {
+	if p.Curve != nil {
+		return p.curveExp(b, e)
+	}
+	x := new(big.Int).SetBytes(b)
+	return x.Exp(x, e, p.N).Bytes()
+}
+
+// expSecret is like exp, but runs in constant time with respect to e, which may
+// be a secret exponent or a secret nonce. Scalar multiplication on the curves
+// of the standard library is already constant time.
+func (p *Params) expSecret(b []byte, e *big.Int) []byte {
+	if p.Curve != nil {
+		return p.curveExp(b, e)
+	}
+	return ctExp(new(big.Int).SetBytes(b), e, p.N, p.exponentBitLen()).Bytes()
+}
+
+// mul returns the product of a and b. a and b must be valid elements, see
+// CheckCiphertext.
+func (p *Params) mul(a, b []byte) []byte {
+	if p.Curve != nil {
+		return p.curveMul(a, b)
+	}
+	x := new(big.Int).SetBytes(a)
+	x.Mul(x, new(big.Int).SetBytes(b))
+	return x.Mod(x, p.N).Bytes()
+}
+
+// generator returns the encoding of the generator of the subgroup of order Q.
+// It must only be called if p.HasGenerator.
+func (p *Params) generator() []byte {
+	if p.Curve != nil {
+		cp := p.Curve.Params()
+		return elliptic.MarshalCompressed(p.Curve, cp.Gx, cp.Gy)
+	}
+	return p.G.Bytes()
+}
+
+// writeElement writes the canonical length-prefixed encoding of b to w, such
+// that equal elements are written equally regardless of leading zeros.
+func (p *Params) writeElement(w io.Writer, b []byte) {
+	if p.Curve != nil {
+		writeBytes(w, b)
+		return
+	}
+	writeInt(w, new(big.Int).SetBytes(b))
+}
+
+// fixedElement returns the encoding of b with the same size for every element.
+func (p *Params) fixedElement(b []byte) []byte {
+	if p.Curve != nil {
+		return b
+	}
+	return new(big.Int).SetBytes(b).FillBytes(make([]byte, (p.N.BitLen()+7)/8))
+}
@@ -0,0 +1,200 @@
+package sra
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Errors returned by commitments and proofs.
+var (
+	// ErrNoGenerator is returned when commitments or proofs are requested
+	// for keys whose Params are not in subgroup mode or have no generator.
+	ErrNoGenerator = errors.New("sra: proofs require subgroup mode and a generator")
+	// ErrInvalidProof is returned when a proof does not verify.
+	ErrInvalidProof = errors.New("sra: invalid proof")
+)
+
+// Commitment returns G^K mod N, a public commitment to the encryption exponent
+// of k. Other players use the commitment to verify proofs of decryption made
+// with k. It requires subgroup mode.
+func (k *Key) Commitment() ([]byte, error) {
+	if k.params == nil || !k.params.HasGenerator() {
+		return nil, ErrNoGenerator
+	}
+	return k.params.expSecret(k.params.generator(), k.K), nil
+}
+
+// ProveDecryption returns a non-interactive proof that plaintext is the
+// decryption of ciphertext with the key committed to by k.Commitment.
+//
+// This is a Chaum–Pedersen proof that log_G(commitment) = log_plaintext
+// (ciphertext), made non-interactive with the Fiat–Shamir heuristic using
+// BLAKE2b. The proof reveals nothing about k. If random is nil,
+// crypto/rand.Reader is used.
+func (k *Key) ProveDecryption(random io.Reader, ciphertext, plaintext []byte) ([]byte, error) {
+	commitment, err := k.Commitment()
+	if err != nil {
+		return nil, err
+	}
+	p := k.params
+	for _, x := range [][]byte{ciphertext, plaintext} {
+		if err := p.CheckCiphertext(x); err != nil {
+			return nil, err
+		}
+	}
+	// Prove knowledge of K such that y = G^K and c = m^K.
+	return proveEqualLogs(p, random, decryptionProofLabel, k.K, p.generator(), commitment, plaintext, ciphertext)
+}
+
+// VerifyDecryption verifies a proof created with Key.ProveDecryption, that
+// plaintext is the decryption of ciphertext with the key committed to by
+// commitment. It returns ErrInvalidProof if verification fails.
+func VerifyDecryption(params *Params, commitment, ciphertext, plaintext, proof []byte) error {
+	if !params.HasGenerator() {
+		return ErrNoGenerator
+	}
+	for _, x := range [][]byte{commitment, ciphertext, plaintext} {
+		if params.CheckCiphertext(x) != nil {
+			return ErrInvalidProof
+		}
+	}
+	return verifyEqualLogs(params, decryptionProofLabel, params.generator(), commitment, plaintext, ciphertext, proof)
+}
+
+// decryptionProofLabel separates proofs of decryption from other proofs of
+// equal logarithms.
+const decryptionProofLabel = "tiwe/sra decryption proof\x00"
+
+// errDifferentParams is returned by Key.ProveRekey for keys with different
+// Params.
+var errDifferentParams = errors.New("sra: keys have different parameters")
+
+// ProveRekey returns a non-interactive proof that rekeyed is the decryption of
+// ciphertext with k, encrypted again with to. Other players verify the proof
+// with VerifyRekey, given the commitments of both keys, see Key.Commitment.
+//
+// This is a Chaum–Pedersen proof that log_{G^K}(G^K') = log_ciphertext
+// (rekeyed), where K and K' are the encryption exponents of k and to. The
+// proof reveals nothing about either key. If random is nil, crypto/rand.Reader
+// is used.
+func (k *Key) ProveRekey(random io.Reader, to *Key, ciphertext, rekeyed []byte) ([]byte, error) {
+	commitment, err := k.Commitment()
+	if err != nil {
+		return nil, err
+	}
+	if !k.params.Equal(to.params) {
+		return nil, errDifferentParams
+	}
+	toCommitment, err := to.Commitment()
+	if err != nil {
+		return nil, err
+	}
+	p := k.params
+	for _, x := range [][]byte{ciphertext, rekeyed} {
+		if err := p.CheckCiphertext(x); err != nil {
+			return nil, err
+		}
+	}
+	// Prove knowledge of x = K'/K such that G^K' = (G^K)^x and rekeyed =
+	// ciphertext^x. In subgroup mode, L is the inverse of K modulo Q.
+	x := new(big.Int).Mul(to.K, k.L)
+	x.Mod(x, p.Q)
+	return proveEqualLogs(p, random, rekeyProofLabel, x, commitment, toCommitment, ciphertext, rekeyed)
+}
+
+// VerifyRekey verifies a proof created with Key.ProveRekey, that rekeyed is the
+// decryption of ciphertext with the key committed to by commitment, encrypted
+// again with the key committed to by toCommitment. It returns ErrInvalidProof
+// if verification fails.
+func VerifyRekey(params *Params, commitment, toCommitment, ciphertext, rekeyed, proof []byte) error {
+	if !params.HasGenerator() {
+		return ErrNoGenerator
+	}
+	for _, x := range [][]byte{commitment, toCommitment, ciphertext, rekeyed} {
+		if params.CheckCiphertext(x) != nil {
+			return ErrInvalidProof
+		}
+	}
+	return verifyEqualLogs(params, rekeyProofLabel, commitment, toCommitment, ciphertext, rekeyed, proof)
+}
+
+// rekeyProofLabel separates proofs of rekeying from other proofs of equal
+// logarithms.
+const rekeyProofLabel = "tiwe/sra rekey proof\x00"
+
+// proveEqualLogs returns a Chaum–Pedersen proof that log_g1(h1) = log_g2(h2) =
+// x, made non-interactive with the Fiat–Shamir heuristic using BLAKE2b. All
+// elements must be valid, and label separates the uses of the proof. If random
+// is nil, crypto/rand.Reader is used.
+func proveEqualLogs(p *Params, random io.Reader, label string, x *big.Int, g1, h1, g2, h2 []byte) ([]byte, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	r, err := rand.Int(random, p.Q)
+	if err != nil {
+		return nil, err
+	}
+	a := p.expSecret(g1, r)
+	b := p.expSecret(g2, r)
+	e := challenge(p, label, g1, h1, g2, h2, a, b)
+	s := new(big.Int).Mul(e, x)
+	s.Add(s, r)
+	s.Mod(s, p.Q)
+	return encodeProof(p, e, s), nil
+}
+
+// verifyEqualLogs verifies a proof created with proveEqualLogs. It returns
+// ErrInvalidProof if verification fails.
+func verifyEqualLogs(p *Params, label string, g1, h1, g2, h2, proof []byte) error {
+	e, s, ok := decodeProof(p, proof)
+	if !ok {
+		return ErrInvalidProof
+	}
+	// Recompute a = g1^s / h1^e and b = g2^s / h2^e.
+	negE := new(big.Int).Sub(p.Q, e)
+	a := p.mul(p.exp(g1, s), p.exp(h1, negE))
+	b := p.mul(p.exp(g2, s), p.exp(h2, negE))
+	if challenge(p, label, g1, h1, g2, h2, a, b).Cmp(e) != 0 {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// challenge returns the Fiat–Shamir challenge for a proof of equal logarithms.
+func challenge(p *Params, label string, g1, h1, g2, h2, a, b []byte) *big.Int {
+	h, _ := blake2b.New512(nil)
+	h.Write([]byte(label))
+	writeInt(h, p.N)
+	writeInt(h, p.Q)
+	for _, x := range [][]byte{g1, h1, g2, h2, a, b} {
+		p.writeElement(h, x)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, p.Q)
+}
+
+// encodeProof encodes e and s as fixed-size big-endian numbers.
+func encodeProof(p *Params, e, s *big.Int) []byte {
+	size := (p.Q.BitLen() + 7) / 8
+	proof := make([]byte, 2*size)
+	e.FillBytes(proof[:size])
+	s.FillBytes(proof[size:])
+	return proof
+}
+
+func decodeProof(p *Params, proof []byte) (e, s *big.Int, ok bool) {
+	size := (p.Q.BitLen() + 7) / 8
+	if len(proof) != 2*size {
+		return nil, nil, false
+	}
+	e = new(big.Int).SetBytes(proof[:size])
+	s = new(big.Int).SetBytes(proof[size:])
+	if e.Cmp(p.Q) >= 0 || s.Cmp(p.Q) >= 0 {
+		return nil, nil, false
+	}
+	return e, s, true
+}
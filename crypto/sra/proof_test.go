@@ -0,0 +1,149 @@
+package sra
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048Q256, MODP2048, MODP3072} {
+		if params.G.Cmp(bigOne) == 0 {
+			t.Errorf("%s: G = 1", params.Name)
+		}
+		if new(big.Int).Exp(params.G, params.Q, params.N).Cmp(bigOne) != 0 {
+			t.Errorf("%s: G does not generate the subgroup of order Q", params.Name)
+		}
+	}
+}
+
+func TestProveDecryption(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048, P256} {
+		params := params.RestrictToSubgroup()
+		t.Run(params.Name, func(t *testing.T) {
+			key := generateKey(t, params)
+			other := generateKey(t, params)
+			commitment, err := key.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherCommitment, err := other.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := params.MapToSubgroup([]byte{42})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Tiles are encrypted by multiple players, the revealed
+			// decryption is usually still a ciphertext.
+			ciphertext := encrypt(t, key, encrypt(t, other, plaintext))
+			partial := decrypt(t, key, ciphertext)
+			proof, err := key.ProveDecryption(nil, ciphertext, partial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyDecryption(params, commitment, ciphertext, partial, proof); err != nil {
+				t.Fatalf("valid proof: %v", err)
+			}
+
+			// A lie about the decryption cannot be proven.
+			lie := plaintext
+			lieProof, err := key.ProveDecryption(nil, ciphertext, lie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tampered := dup(proof)
+			tampered[len(tampered)-1] ^= 1
+			tests := []struct {
+				name                  string
+				commitment, plaintext []byte
+				proof                 []byte
+			}{
+				{"wrong plaintext", commitment, lie, proof},
+				{"proof of a lie", commitment, lie, lieProof},
+				{"wrong commitment", otherCommitment, partial, proof},
+				{"tampered proof", commitment, partial, tampered},
+				{"truncated proof", commitment, partial, proof[1:]},
+				{"empty proof", commitment, partial, nil},
+			}
+			for _, tt := range tests {
+				err := VerifyDecryption(params, tt.commitment, ciphertext, tt.plaintext, tt.proof)
+				if err != ErrInvalidProof {
+					t.Errorf("%s: got error %v, want %v", tt.name, err, ErrInvalidProof)
+				}
+			}
+		})
+	}
+}
+
+func TestProveDecryptionRequiresSubgroup(t *testing.T) {
+	if MODP1024.HasGenerator() || !MODP1024.RestrictToSubgroup().HasGenerator() {
+		t.Errorf("HasGenerator: want true only in subgroup mode")
+	}
+	key := generateKey(t, MODP1024)
+	if _, err := key.Commitment(); err != ErrNoGenerator {
+		t.Errorf("Commitment: got error %v, want %v", err, ErrNoGenerator)
+	}
+	if err := VerifyDecryption(MODP1024, nil, nil, nil, nil); err != ErrNoGenerator {
+		t.Errorf("VerifyDecryption: got error %v, want %v", err, ErrNoGenerator)
+	}
+}
+
+func TestProveRekey(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048, P256} {
+		params := params.RestrictToSubgroup()
+		t.Run(params.Name, func(t *testing.T) {
+			key := generateKey(t, params)
+			to := generateKey(t, params)
+			other := generateKey(t, params)
+			commitment, err := key.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			toCommitment, err := to.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := params.MapToSubgroup([]byte{42})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ciphertext := encrypt(t, key, encrypt(t, other, plaintext))
+			rekeyed := encrypt(t, to, decrypt(t, key, ciphertext))
+			proof, err := key.ProveRekey(nil, to, ciphertext, rekeyed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyRekey(params, commitment, toCommitment, ciphertext, rekeyed, proof); err != nil {
+				t.Fatalf("valid proof: %v", err)
+			}
+
+			// A substituted tile cannot be proven.
+			another, err := params.MapToSubgroup([]byte{43})
+			if err != nil {
+				t.Fatal(err)
+			}
+			substitute := encrypt(t, to, encrypt(t, other, another))
+			substituteProof, err := key.ProveRekey(nil, to, ciphertext, substitute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name                     string
+				commitment, toCommitment []byte
+				rekeyed, proof           []byte
+			}{
+				{"substituted tile", commitment, toCommitment, substitute, proof},
+				{"proof of a substitute", commitment, toCommitment, substitute, substituteProof},
+				{"wrong commitment", toCommitment, commitment, rekeyed, proof},
+				{"truncated proof", commitment, toCommitment, rekeyed, proof[1:]},
+			}
+			for _, tt := range tests {
+				err := VerifyRekey(params, tt.commitment, tt.toCommitment, ciphertext, tt.rekeyed, tt.proof)
+				if err != ErrInvalidProof {
+					t.Errorf("%s: got error %v, want %v", tt.name, err, ErrInvalidProof)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package sra
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultShuffleRounds is the recommended number of rounds of shuffle proofs.
+// A cheating player can forge a proof with r rounds with probability 2^-r per
+// attempt. Since proofs are non-interactive, attempts can be made offline, so
+// the number of rounds must be much larger than for an interactive proof.
+const DefaultShuffleRounds = 80
+
+// maxShuffleLen is the maximum number of values in a shuffle proof, such that
+// every index fits in two bytes.
+const maxShuffleLen = 1 << 16
+
+// maxShuffleRounds is the maximum number of rounds of a shuffle proof, such
+// that the number of rounds fits in two bytes.
+const maxShuffleRounds = 1<<16 - 1
+
+// Shuffle encrypts every value in in with k and returns the encrypted values in
+// random order, along with a non-interactive proof that out is a permutation of
+// the encryption of in. Other players verify the proof with VerifyShuffle,
+// learning nothing about the permutation or about k. It requires subgroup mode.
+//
+// The proof is a cut-and-choose argument with the given number of rounds,
+// see DefaultShuffleRounds. In each round, the prover commits to an
+// intermediate shuffle of in, and reveals either how to obtain it from in or
+// how to obtain it from out, depending on a Fiat–Shamir challenge computed
+// with BLAKE2b. Proving and verifying cost len(in) modular exponentiations
+// per round.
+//
+// If random is nil, crypto/rand.Reader is used.
+func (k *Key) Shuffle(ctx context.Context, random io.Reader, in [][]byte, rounds int) (out [][]byte, proof []byte, err error) {
+	if k.params == nil || !k.params.HasGenerator() {
+		return nil, nil, ErrNoGenerator
+	}
+	if len(in) > maxShuffleLen || rounds < 1 || rounds > maxShuffleRounds {
+		return nil, nil, ErrInvalidProof
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+	p := k.params
+	perm, err := randomPerm(random, len(in))
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := k.EncryptBatch(ctx, in)
+	if err != nil {
+		return nil, nil, err
+	}
+	out = permute(encrypted, perm)
+
+	// Commit to intermediate shuffles z = in[sigma[i]]^e.
+	sigmas := make([][]int, rounds)
+	exps := make([]*big.Int, rounds)
+	digests := make([][]byte, rounds)
+	for j := range sigmas {
+		if sigmas[j], err = randomPerm(random, len(in)); err != nil {
+			return nil, nil, err
+		}
+		if exps[j], err = randomExponent(random, p.Q); err != nil {
+			return nil, nil, err
+		}
+		z, err := expBatch(ctx, permute(in, sigmas[j]), exps[j], p.expSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+		digests[j] = shuffleDigest(p, z)
+	}
+
+	size := (p.Q.BitLen() + 7) / 8
+	proof = make([]byte, 2, 2+rounds*(blake2b.Size256+2*len(in)+size))
+	binary.BigEndian.PutUint16(proof, uint16(rounds))
+	for _, d := range digests {
+		proof = append(proof, d...)
+	}
+	bits := shuffleChallenge(p, in, out, proof)
+	for j, sigma := range sigmas {
+		var reveal []int
+		e := new(big.Int)
+		if bit(bits, j) == 0 {
+			// Reveal how to compute z from in.
+			reveal = sigma
+			e.Set(exps[j])
+		} else {
+			// Reveal how to compute z from out: since out[i] =
+			// in[perm[i]]^K, z[tau[i]] = out[i]^(e/K) where
+			// tau[i] = sigma^-1[perm[i]].
+			inv := make([]int, len(sigma))
+			for i, s := range sigma {
+				inv[s] = i
+			}
+			reveal = make([]int, len(perm))
+			for i, s := range perm {
+				reveal[i] = inv[s]
+			}
+			e.Mul(exps[j], k.L)
+			e.Mod(e, p.Q)
+		}
+		for _, i := range reveal {
+			proof = append(proof, byte(i>>8), byte(i))
+		}
+		proof = append(proof, e.FillBytes(make([]byte, size))...)
+	}
+	return out, proof, nil
+}
+
+// VerifyShuffle verifies a proof created with Key.Shuffle, that out is a
+// permutation of the encryption of in with a single key. The proof must have
+// at least the given number of rounds. It returns ErrInvalidProof if
+// verification fails, or the error of ctx if it is canceled.
+func VerifyShuffle(ctx context.Context, params *Params, in, out [][]byte, proof []byte, rounds int) error {
+	if !params.HasGenerator() {
+		return ErrNoGenerator
+	}
+	n := len(in)
+	if len(out) != n || n > maxShuffleLen || len(proof) < 2 {
+		return ErrInvalidProof
+	}
+	r := int(binary.BigEndian.Uint16(proof))
+	size := (params.Q.BitLen() + 7) / 8
+	if r < rounds || r < 1 || len(proof) != 2+r*(blake2b.Size256+2*n+size) {
+		return ErrInvalidProof
+	}
+	for _, values := range [][][]byte{in, out} {
+		for _, b := range values {
+			if params.CheckCiphertext(b) != nil {
+				return ErrInvalidProof
+			}
+		}
+	}
+	digests := proof[2 : 2+r*blake2b.Size256]
+	bits := shuffleChallenge(params, in, out, proof[:2+len(digests)])
+	reveals := proof[2+len(digests):]
+	for j := 0; j < r; j++ {
+		reveal := reveals[:2*n]
+		e := new(big.Int).SetBytes(reveals[2*n : 2*n+size])
+		reveals = reveals[2*n+size:]
+		if e.Sign() == 0 || e.Cmp(params.Q) >= 0 {
+			return ErrInvalidProof
+		}
+		perm := make([]int, n)
+		seen := make([]bool, n)
+		for i := range perm {
+			v := int(reveal[2*i])<<8 | int(reveal[2*i+1])
+			if v >= n || seen[v] {
+				return ErrInvalidProof
+			}
+			perm[i], seen[v] = v, true
+		}
+		var z [][]byte
+		if bit(bits, j) == 0 {
+			var err error
+			if z, err = expBatch(ctx, permute(in, perm), e, params.exp); err != nil {
+				return err
+			}
+		} else {
+			zt, err := expBatch(ctx, out, e, params.exp)
+			if err != nil {
+				return err
+			}
+			z = make([][]byte, n)
+			for i, t := range perm {
+				z[t] = zt[i]
+			}
+		}
+		want := digests[j*blake2b.Size256 : (j+1)*blake2b.Size256]
+		if !bytes.Equal(shuffleDigest(params, z), want) {
+			return ErrInvalidProof
+		}
+	}
+	return nil
+}
+
+// randomPerm returns a uniformly random permutation of the integers [0,n).
+func randomPerm(random io.Reader, n int) ([]int, error) {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j, err := rand.Int(random, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		perm[i], perm[j.Int64()] = perm[j.Int64()], perm[i]
+	}
+	return perm, nil
+}
+
+// randomExponent returns a uniformly random number in the range [1,q).
+func randomExponent(random io.Reader, q *big.Int) (*big.Int, error) {
+	e, err := rand.Int(random, new(big.Int).Sub(q, bigOne))
+	if err != nil {
+		return nil, err
+	}
+	return e.Add(e, bigOne), nil
+}
+
+// permute returns values reordered such that the i-th element is
+// values[perm[i]].
+func permute(values [][]byte, perm []int) [][]byte {
+	out := make([][]byte, len(perm))
+	for i, j := range perm {
+		out[i] = values[j]
+	}
+	return out
+}
+
+// expBatch raises every value to the power of e with exp, either Params.exp or
+// Params.expSecret.
+func expBatch(ctx context.Context, values [][]byte, e *big.Int, exp func([]byte, *big.Int) []byte) ([][]byte, error) {
+	return batch(ctx, values, func(i int, b []byte) ([]byte, error) {
+		return exp(b, e), nil
+	})
+}
+
+// shuffleDigest returns the commitment to an intermediate shuffle.
+func shuffleDigest(p *Params, values [][]byte) []byte {
+	h, _ := blake2b.New256(nil)
+	for _, b := range values {
+		h.Write(p.fixedElement(b))
+	}
+	return h.Sum(nil)
+}
+
+// shuffleChallenge returns the Fiat–Shamir challenge for a shuffle proof, one
+// bit per round. header holds the number of rounds and the commitments to
+// intermediate shuffles.
+func shuffleChallenge(p *Params, in, out [][]byte, header []byte) []byte {
+	rounds := int(binary.BigEndian.Uint16(header))
+	h, _ := blake2b.NewXOF(uint32((rounds+7)/8), nil)
+	h.Write([]byte("tiwe/sra shuffle proof\x00"))
+	writeInt(h, p.N)
+	writeInt(h, p.Q)
+	p.writeElement(h, p.generator())
+	for _, values := range [][][]byte{in, out} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(values)))
+		h.Write(n[:])
+		for _, b := range values {
+			p.writeElement(h, b)
+		}
+	}
+	h.Write(header)
+	bits := make([]byte, (rounds+7)/8)
+	io.ReadFull(h, bits)
+	return bits
+}
+
+func bit(b []byte, i int) byte {
+	return b[i/8] >> (i % 8) & 1
+}
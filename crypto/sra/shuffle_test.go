@@ -0,0 +1,156 @@
+package sra
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+// testShuffleRounds keeps tests fast. Soundness is not under test.
+const testShuffleRounds = 16
+
+func TestShuffle(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048Q256, P256} {
+		params := params.RestrictToSubgroup()
+		t.Run(params.Name, func(t *testing.T) {
+			ctx := context.Background()
+			key := generateKey(t, params)
+			in := testPlaintexts(t, params, 20)
+			out, proof, err := key.Shuffle(ctx, nil, in, testShuffleRounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyShuffle(ctx, params, in, out, proof, testShuffleRounds); err != nil {
+				t.Fatalf("valid proof: %v", err)
+			}
+			// out must be a permutation of the encryption of in.
+			count := make(map[string]int)
+			for _, p := range in {
+				count[string(p)]++
+			}
+			for _, c := range out {
+				count[string(decrypt(t, key, c))]--
+			}
+			for p, n := range count {
+				if n != 0 {
+					t.Errorf("plaintext %x: count mismatch %d", p, n)
+				}
+			}
+
+			duplicate := dup2(out)
+			duplicate[0] = duplicate[1]
+			swapped := dup2(out)
+			swapped[0], swapped[1] = swapped[1], swapped[0]
+			substituted := dup2(out)
+			substituted[0] = encrypt(t, key, encrypt(t, key, in[0]))
+			otherIn := dup2(in)
+			otherIn[0], otherIn[1] = otherIn[1], otherIn[0]
+			tampered := dup(proof)
+			tampered[len(tampered)-1] ^= 1
+			tests := []struct {
+				name    string
+				in, out [][]byte
+				proof   []byte
+				rounds  int
+			}{
+				{"duplicate tile", in, duplicate, proof, testShuffleRounds},
+				{"swapped output", in, swapped, proof, testShuffleRounds},
+				{"substituted tile", in, substituted, proof, testShuffleRounds},
+				{"different input", otherIn, out, proof, testShuffleRounds},
+				{"missing tile", in, out[1:], proof, testShuffleRounds},
+				{"tampered proof", in, out, tampered, testShuffleRounds},
+				{"truncated proof", in, out, proof[:len(proof)-1], testShuffleRounds},
+				{"empty proof", in, out, nil, testShuffleRounds},
+				{"too few rounds", in, out, proof, testShuffleRounds + 1},
+			}
+			for _, tt := range tests {
+				err := VerifyShuffle(ctx, params, tt.in, tt.out, tt.proof, tt.rounds)
+				if err != ErrInvalidProof {
+					t.Errorf("%s: got error %v, want %v", tt.name, err, ErrInvalidProof)
+				}
+			}
+		})
+	}
+}
+
+func TestShuffleRequiresSubgroup(t *testing.T) {
+	ctx := context.Background()
+	key := generateKey(t, MODP1024)
+	if _, _, err := key.Shuffle(ctx, nil, [][]byte{{1}}, testShuffleRounds); err != ErrNoGenerator {
+		t.Errorf("Shuffle: got error %v, want %v", err, ErrNoGenerator)
+	}
+	if err := VerifyShuffle(ctx, MODP1024, nil, nil, nil, testShuffleRounds); err != ErrNoGenerator {
+		t.Errorf("VerifyShuffle: got error %v, want %v", err, ErrNoGenerator)
+	}
+}
+
+func TestShuffleCanceled(t *testing.T) {
+	params := MODP1024.RestrictToSubgroup()
+	key := generateKey(t, params)
+	in := testPlaintexts(t, params, 5)
+	out, proof, err := key.Shuffle(context.Background(), nil, in, testShuffleRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := VerifyShuffle(ctx, params, in, out, proof, testShuffleRounds); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func dup2(b [][]byte) [][]byte {
+	return append([][]byte(nil), b...)
+}
+
+// BenchmarkShuffle measures the shuffle phase of a game with a deck of 106
+// tiles: every player, in turn, encrypts and shuffles the pool, and every other
+// player verifies the result. The Plain benchmarks shuffle without proofs.
+func BenchmarkShuffle(b *testing.B) {
+	ctx := context.Background()
+	for _, params := range []*Params{MODP1024, MODP2048Q256, P256} {
+		params := params.RestrictToSubgroup()
+		deck := testPlaintexts(b, params, 106)
+		for players := 2; players <= 4; players++ {
+			keys := make([]*Key, players)
+			for i := range keys {
+				keys[i] = generateKey(b, params)
+			}
+			name := fmt.Sprintf("%s/players=%d", params.Name, players)
+			b.Run(name+"/Plain", func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					pool := deck
+					for _, key := range keys {
+						out, err := key.EncryptBatch(ctx, pool)
+						if err != nil {
+							b.Fatal(err)
+						}
+						perm, err := randomPerm(rand.Reader, len(out))
+						if err != nil {
+							b.Fatal(err)
+						}
+						pool = permute(out, perm)
+					}
+				}
+			})
+			b.Run(name+"/Proof", func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					pool := deck
+					for _, key := range keys {
+						out, proof, err := key.Shuffle(ctx, nil, pool, DefaultShuffleRounds)
+						if err != nil {
+							b.Fatal(err)
+						}
+						for i := 1; i < players; i++ {
+							if err := VerifyShuffle(ctx, params, pool, out, proof, DefaultShuffleRounds); err != nil {
+								b.Fatal(err)
+							}
+						}
+						pool = out
+					}
+				}
+			})
+		}
+	}
+}
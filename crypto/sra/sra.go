@@ -14,21 +14,42 @@
 package sra
 
 import (
-	"crypto/rand"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
 	"io"
 	"math/big"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+	"golang.org/x/crypto/blake2b"
 )
 
-// SRA encryption requires a large prime number. This package uses a fixed
-// documented prime instead of generating one.
-// This is the 1024-bit MODP Group with 160-bit Prime Order Subgroup from
-// RFC 5114, section 2.1.
+// SRA encryption requires a large prime number. This package uses fixed
+// documented primes instead of generating one.
+//
+// The 1024-bit MODP Group with 160-bit Prime Order Subgroup is from RFC 5114,
+// section 2.1, and the 2048-bit MODP Group with 256-bit Prime Order Subgroup is
+// from section 2.3.
 //
 //  https://tools.ietf.org/html/rfc5114#section-2.1
+//  https://tools.ietf.org/html/rfc5114#section-2.3
+//
+// The 2048-bit and 3072-bit MODP Groups are from RFC 3526, sections 3 and 4.
+// Their primes are safe primes, N = 2Q+1 with Q prime.
+//
+//  https://tools.ietf.org/html/rfc3526
 const (
-	primeHex = "B10B8F96A080E01DDE92DE5EAE5D54EC52C99FBCFB06A3C69A6A9DCA52D23B616073E28675A23D189838EF1E2EE652C013ECB4AEA906112324975C3CD49B83BFACCBDD7D90C4BD7098488E9C219A73724EFFD6FAE5644738FAA31A4FF55BCCC0A151AF5F0DC8B4BD45BF37DF365C1A65E68CFDA76D4DA708DF1FB2BC2E4A4371"
-	// generatorHex = "A4D1CBD5C3FD34126765A442EFB99905F8104DD258AC507FD6406CFF14266D31266FEA1E5C41564B777E690F5504F213160217B4B01B886A5E91547F9E2749F4D7FBD7D3B9A92EE1909D0D2263F80A76A6A24C087A091F531DBF0A0169B6A28AD662A4D18E73AFA32D779D5918D08BC8858F4DCEF97C2A24855E6EEB22B3B2E5"
-	// qHex = "F518AA8781A8DF278ABA4E7D64B7CB9D49462353"
+	primeHex     = "B10B8F96A080E01DDE92DE5EAE5D54EC52C99FBCFB06A3C69A6A9DCA52D23B616073E28675A23D189838EF1E2EE652C013ECB4AEA906112324975C3CD49B83BFACCBDD7D90C4BD7098488E9C219A73724EFFD6FAE5644738FAA31A4FF55BCCC0A151AF5F0DC8B4BD45BF37DF365C1A65E68CFDA76D4DA708DF1FB2BC2E4A4371"
+	generatorHex = "A4D1CBD5C3FD34126765A442EFB99905F8104DD258AC507FD6406CFF14266D31266FEA1E5C41564B777E690F5504F213160217B4B01B886A5E91547F9E2749F4D7FBD7D3B9A92EE1909D0D2263F80A76A6A24C087A091F531DBF0A0169B6A28AD662A4D18E73AFA32D779D5918D08BC8858F4DCEF97C2A24855E6EEB22B3B2E5"
+	qHex         = "F518AA8781A8DF278ABA4E7D64B7CB9D49462353"
+
+	prime2048q256Hex     = "87A8E61DB4B6663CFFBBD19C651959998CEEF608660DD0F25D2CEED4435E3B00E00DF8F1D61957D4FAF7DF4561B2AA3016C3D91134096FAA3BF4296D830E9A7C209E0C6497517ABD5A8A9D306BCF67ED91F9E6725B4758C022E0B1EF4275BF7B6C5BFC11D45F9088B941F54EB1E59BB8BC39A0BF12307F5C4FDB70C581B23F76B63ACAE1CAA6B7902D52526735488A0EF13C6D9A51BFA4AB3AD8347796524D8EF6A167B5A41825D967E144E5140564251CCACB83E6B486F6B3CA3F7971506026C0B857F689962856DED4010ABD0BE621C3A3960A54E710C375F26375D7014103A4B54330C198AF126116D2276E11715F693877FAD7EF09CADB094AE91E1A1597"
+	generator2048q256Hex = "3FB32C9B73134D0B2E77506660EDBD484CA7B18F21EF205407F4793A1A0BA12510DBC15077BE463FFF4FED4AAC0BB555BE3A6C1B0C6B47B1BC3773BF7E8C6F62901228F8C28CBB18A55AE31341000A650196F931C77A57F2DDF463E5E9EC144B777DE62AAAB8A8628AC376D282D6ED3864E67982428EBC831D14348F6F2F9193B5045AF2767164E1DFC967C1FB3F2E55A4BD1BFFE83B9C80D052B985D182EA0ADB2A3B7313D3FE14C8484B1E052588B9B7D2BBD2DF016199ECD06E1557CD0915B3353BBB64E0EC377FD028370DF92B52C7891428CDC67EB6184B523D1DB246C32F63078490F00EF8D647D148D47954515E2327CFEF98C582664B4C0F6CC41659"
+	q2048q256Hex         = "8CF83642A709A097B447997640129DA299B1A47D1EB3750BA308B0FE64F5FBD3"
+
+	prime2048Hex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF"
+
+	prime3072Hex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E208E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
 )
 
 // minBitLen is the minimum number of bits required for generated encryption and
@@ -38,17 +59,101 @@ const minBitLen = 160
 // Reusable big.Int values, allocated only once globally.
 var (
 	bigOne = big.NewInt(1)
-	// defaultN is a large prime used in the encryption scheme.
-	defaultN = fromHex(primeHex)
-	// defaultTotient is the value of Euler's totient function applied to
-	// defaultN. Since defaultN is prime, the totient is trivially N-1.
-	defaultTotient = new(big.Int).Sub(defaultN, bigOne)
-	// defaultMaxK is the upper limit for the encryption exponent K.
-	// Limiting K makes encryption faster, and, consequently, reduces the
-	// total time for encryption+decryption too.
-	defaultMaxK = new(big.Int).Lsh(bigOne, minBitLen)
 )
 
+// Errors returned by encryption and decryption. Ciphertexts typically come
+// from other players, so callers should treat these errors as a sign of a
+// misbehaving peer.
+var (
+	// ErrMessageTooLarge is returned when a plaintext is not smaller than N.
+	ErrMessageTooLarge = errors.New("sra: message is too large")
+	// ErrZeroMessage is returned when a plaintext is zero. Zero is a fixed
+	// point of the encryption function and would be sent in clear.
+	ErrZeroMessage = errors.New("sra: message is zero")
+	// ErrInvalidCiphertext is returned when a ciphertext is not in the
+	// range [1,N).
+	ErrInvalidCiphertext = errors.New("sra: invalid ciphertext")
+	// ErrNotInSubgroup is returned in subgroup mode when a plaintext or a
+	// ciphertext is not in the subgroup of order Q.
+	ErrNotInSubgroup = errors.New("sra: value is not in the prime-order subgroup")
+)
+
+// Params are the group parameters of SRA keys. All players in a game must use
+// the same Params, otherwise encryption is not commutative.
+type Params struct {
+	// Name identifies the parameters for humans.
+	Name string
+	// N is a large prime.
+	N *big.Int
+	// Q is the order of a large prime-order subgroup of the multiplicative
+	// group modulo N.
+	Q *big.Int
+	// ExpBitLen is the number of bits of generated encryption exponents.
+	// Limiting the encryption exponent makes encryption faster, and,
+	// consequently, reduces the total time for encryption+decryption too.
+	ExpBitLen int
+	// Subgroup restricts keys, plaintexts and ciphertexts to the subgroup
+	// of order Q. Exponents are generated modulo Q, and values outside of
+	// the subgroup are rejected, such that a malicious player cannot learn
+	// information by sending values in small subgroups.
+	Subgroup bool
+	// G is a generator of the subgroup of order Q. It is used for public
+	// commitments to exponents, see Key.Commitment.
+	G *big.Int
+	// Curve, if not nil, replaces modular exponentiation with scalar
+	// multiplication of points on the curve, see P256. N is the prime of
+	// the underlying field and Q is the order of the group of points.
+	// Plaintexts and ciphertexts are compressed points, and the curve's
+	// base point is the generator.
+	Curve elliptic.Curve
+}
+
+// Built-in group parameters.
+var (
+	// MODP1024 is the 1024-bit MODP Group with 160-bit Prime Order
+	// Subgroup from RFC 5114. Its discrete logarithm security margin is no
+	// longer recommended, prefer MODP2048 or larger.
+	MODP1024 = &Params{
+		Name:      "RFC5114-MODP1024-160",
+		N:         fromHex(primeHex),
+		Q:         fromHex(qHex),
+		ExpBitLen: minBitLen,
+		G:         fromHex(generatorHex),
+	}
+	// MODP2048Q256 is the 2048-bit MODP Group with 256-bit Prime Order
+	// Subgroup from RFC 5114. In subgroup mode, its exponents are much
+	// shorter than those of MODP2048, making decryption and proofs faster.
+	MODP2048Q256 = &Params{
+		Name:      "RFC5114-MODP2048-256",
+		N:         fromHex(prime2048q256Hex),
+		Q:         fromHex(q2048q256Hex),
+		ExpBitLen: 256,
+		G:         fromHex(generator2048q256Hex),
+	}
+	// MODP2048 is the 2048-bit MODP Group from RFC 3526.
+	MODP2048 = safePrimeParams("RFC3526-MODP2048", prime2048Hex, 224)
+	// MODP3072 is the 3072-bit MODP Group from RFC 3526.
+	MODP3072 = safePrimeParams("RFC3526-MODP3072", prime3072Hex, 256)
+
+	// DefaultParams are the parameters used by GenerateKey.
+	DefaultParams = MODP2048
+)
+
+func safePrimeParams(name, hex string, expBitLen int) *Params {
+	n := fromHex(hex)
+	q := new(big.Int).Sub(n, bigOne)
+	q.Rsh(q, 1)
+	return &Params{
+		Name:      name,
+		N:         n,
+		Q:         q,
+		ExpBitLen: expBitLen,
+		// Since N ≡ 7 (mod 8), 2 is a quadratic residue and generates
+		// the subgroup of order Q.
+		G: big.NewInt(2),
+	}
+}
+
 func fromHex(hex string) *big.Int {
 	n, ok := new(big.Int).SetString(hex, 16)
 	if !ok {
@@ -57,62 +162,291 @@ func fromHex(hex string) *big.Int {
 	return n
 }
 
+// RestrictToSubgroup returns a copy of p in subgroup mode, or p itself if it is
+// already in subgroup mode.
+func (p *Params) RestrictToSubgroup() *Params {
+	if p.Subgroup {
+		return p
+	}
+	q := *p
+	q.Name += "-subgroup"
+	q.Subgroup = true
+	return &q
+}
+
+// HasGenerator reports whether p supports commitments and proofs, which require
+// subgroup mode and a generator, see Key.Commitment.
+func (p *Params) HasGenerator() bool {
+	return p.Subgroup && (p.G != nil || p.Curve != nil)
+}
+
+// Equal reports whether p and q describe the same group and mode. Keys
+// generated with equal Params can be used together. ExpBitLen and Name are not
+// compared.
+func (p *Params) Equal(q *Params) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return p.N.Cmp(q.N) == 0 && p.Q.Cmp(q.Q) == 0 && p.Subgroup == q.Subgroup && equalInts(p.G, q.G) && p.Curve == q.Curve
+}
+
+// equalInts reports whether x and y are both nil or equal.
+func equalInts(x, y *big.Int) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x.Cmp(y) == 0
+}
+
+// ID returns a digest of the group described by p, suitable for comparing
+// parameters with other players without exchanging the full numbers.
+func (p *Params) ID() [32]byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/sra params\x00"))
+	writeInt(h, p.N)
+	writeInt(h, p.Q)
+	if p.Subgroup {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	if p.G != nil {
+		writeInt(h, p.G)
+	}
+	if p.Curve != nil {
+		writeBytes(h, []byte(p.Curve.Params().Name))
+	}
+	var id [32]byte
+	h.Sum(id[:0])
+	return id
+}
+
+// writeInt writes the length-prefixed big-endian bytes of x to w.
+func writeInt(w io.Writer, x *big.Int) {
+	writeBytes(w, x.Bytes())
+}
+
+// CheckCiphertext returns ErrInvalidCiphertext if ciphertext cannot have been
+// produced by encryption with keys using p. In subgroup mode, it returns
+// ErrNotInSubgroup if ciphertext is not in the subgroup of order Q. For elliptic
+// curves, it returns ErrNotOnCurve if ciphertext is not a point on the curve.
+func (p *Params) CheckCiphertext(ciphertext []byte) error {
+	if p.Curve != nil {
+		return p.checkPoint(ciphertext)
+	}
+	return p.checkCiphertext(new(big.Int).SetBytes(ciphertext))
+}
+
+func (p *Params) checkCiphertext(c *big.Int) error {
+	if c.Sign() == 0 || c.Cmp(p.N) >= 0 {
+		return ErrInvalidCiphertext
+	}
+	if p.Subgroup && !p.inSubgroup(c) {
+		return ErrNotInSubgroup
+	}
+	return nil
+}
+
+// inSubgroup reports whether x, in the range [1,N), is in the subgroup of
+// order Q.
+func (p *Params) inSubgroup(x *big.Int) bool {
+	// For safe primes, the subgroup of order Q is the subgroup of
+	// quadratic residues, and checking the Legendre symbol is much cheaper
+	// than exponentiation.
+	if p.isSafePrime() {
+		return big.Jacobi(x, p.N) == 1
+	}
+	return new(big.Int).Exp(x, p.Q, p.N).Cmp(bigOne) == 0
+}
+
+// isSafePrime reports whether N = 2Q+1.
+func (p *Params) isSafePrime() bool {
+	n := new(big.Int).Lsh(p.Q, 1)
+	return n.Add(n, bigOne).Cmp(p.N) == 0
+}
+
+// MapToSubgroup maps x to an element of the subgroup of order Q, computing
+// x^((N-1)/Q) mod N. Distinct small values of x map to distinct elements with
+// overwhelming probability. It returns ErrZeroMessage or ErrMessageTooLarge if
+// x is not in the range [1,N).
+//
+// For elliptic curves, x is hashed to a point on the curve instead, see
+// hashToCurve, and any x is valid.
+func (p *Params) MapToSubgroup(x []byte) ([]byte, error) {
+	if p.Curve != nil {
+		return p.hashToCurve(x), nil
+	}
+	m := new(big.Int).SetBytes(x)
+	if m.Sign() == 0 {
+		return nil, ErrZeroMessage
+	}
+	if m.Cmp(p.N) >= 0 {
+		return nil, ErrMessageTooLarge
+	}
+	cofactor := p.totient()
+	cofactor.Div(cofactor, p.Q)
+	return m.Exp(m, cofactor, p.N).Bytes(), nil
+}
+
+// exponentBitLen returns the bit length of the order of the group in which
+// exponents operate, Q in subgroup mode, otherwise N-1.
+func (p *Params) exponentBitLen() int {
+	if p.Subgroup {
+		return p.Q.BitLen()
+	}
+	return p.N.BitLen()
+}
+
+// totient returns Euler's totient function applied to p.N. Since N is prime,
+// the totient is trivially N-1.
+func (p *Params) totient() *big.Int {
+	return new(big.Int).Sub(p.N, bigOne)
+}
+
 // A Key represents an SRA key.
 type Key struct {
-	// N is a large prime.
+	// N is a large prime. For elliptic curves, it is the prime of the
+	// underlying field.
 	N *big.Int
 	// K is the encryption exponent.
 	K *big.Int
 	// L is the decryption exponent.
 	L *big.Int
+
+	params *Params
+}
+
+// Key implements commutative.Key.
+var _ commutative.Key = (*Key)(nil)
+
+// Params returns the group parameters of k, a *Params. For keys not created by
+// this package, it returns Params describing only k.N, not in subgroup mode.
+func (k *Key) Params() commutative.Params {
+	return k.group()
+}
+
+// group is like Params, but returns the concrete type.
+func (k *Key) group() *Params {
+	if k.params != nil {
+		return k.params
+	}
+	return &Params{N: k.N, Q: new(big.Int)}
 }
 
-// GenerateKey generates a Key using the given random source (e.g.,
-// crypto/rand.Reader).
-func GenerateKey(random io.Reader) *Key {
-	key := &Key{N: defaultN}
+// GenerateKey generates a Key with DefaultParams using the given random source
+// (e.g., crypto/rand.Reader).
+func GenerateKey(random io.Reader) (*Key, error) {
+	return GenerateKeyWithParams(random, DefaultParams)
+}
+
+// GenerateKeyWithParams generates a Key with the given group parameters using
+// the given random source (e.g., crypto/rand.Reader). In subgroup mode, the
+// exponents are generated modulo Q.
+//
+// The same stream of random bytes always generates the same key, so a
+// deterministic source, such as NewDeterministic in package
+// github.com/rhcarvalho/tiwe/crypto/rand, makes tests reproducible.
+func GenerateKeyWithParams(random io.Reader, params *Params) (*Key, error) {
+	bitLen := params.ExpBitLen
+	if bitLen < minBitLen {
+		bitLen = minBitLen
+	}
+	// order is the order of the group in which exponents operate.
+	order := params.totient()
+	if params.Subgroup {
+		order = params.Q
+	}
+	key := &Key{N: params.N, params: params}
 	var err error
 	g := new(big.Int)
+	buf := make([]byte, (bitLen+7)/8)
 start:
-	key.K, err = rand.Int(random, defaultMaxK)
-	if err != nil {
-		panic("sra: cannot generate random number: " + err.Error())
+	// Read exactly the bytes needed for a bitLen-bit number, such that keys
+	// derived from a deterministic stream (see DeriveKey) do not depend on
+	// implementation details of other packages.
+	if _, err = io.ReadFull(random, buf); err != nil {
+		return nil, fmt.Errorf("sra: cannot generate random number: %w", err)
+	}
+	key.K = new(big.Int).SetBytes(buf)
+	// Clear excess bits from the most significant byte.
+	for i := bitLen; i < 8*len(buf); i++ {
+		key.K.SetBit(key.K, i, 0)
 	}
-	// Set K's highest bit to ensure that it has minBitLen
+	// Set K's highest bit to ensure that it has bitLen
 	// significant bits.
-	key.K.SetBit(key.K, minBitLen-1, 1)
+	key.K.SetBit(key.K, bitLen-1, 1)
 	// Set K's lowest bit to ensure it is odd. In order to have
 	// GCD(K, Phi(N)) == 1, K must be odd, because Phi(N) is even
 	// (it is a prime minus one).
 	key.K.SetBit(key.K, 0, 1)
-	g.GCD(nil, nil, key.K, defaultTotient)
+	if key.K.Cmp(order) >= 0 {
+		goto start
+	}
+	g.GCD(nil, nil, key.K, order)
 	if g.Cmp(bigOne) != 0 {
 		goto start
 	}
 	// Repurpose g to avoid an allocation.
-	key.L = g.ModInverse(key.K, defaultTotient)
+	key.L = g.ModInverse(key.K, order)
 	if key.L.BitLen() < minBitLen {
 		goto start
 	}
-	return key
+	return key, nil
 }
 
-// Encrypt encrypts plaintext.
-func (k *Key) Encrypt(plaintext []byte) []byte {
+// Encrypt encrypts plaintext. It returns ErrZeroMessage or ErrMessageTooLarge
+// if plaintext does not represent a number in the range [1,N). In subgroup
+// mode, it returns ErrNotInSubgroup if plaintext is not in the subgroup of
+// order Q, see Params.MapToSubgroup. For elliptic curves, it returns
+// ErrNotOnCurve if plaintext is not a point on the curve.
+func (k *Key) Encrypt(plaintext []byte) ([]byte, error) {
+	if k.curve() {
+		if err := k.params.checkPoint(plaintext); err != nil {
+			return nil, err
+		}
+		return k.params.curveExp(plaintext, k.K), nil
+	}
 	m := new(big.Int).SetBytes(plaintext)
+	if m.Sign() == 0 {
+		return nil, ErrZeroMessage
+	}
 	if m.Cmp(k.N) >= 0 {
-		panic("plaintext is too long")
+		return nil, ErrMessageTooLarge
+	}
+	if k.subgroup() && !k.params.inSubgroup(m) {
+		return nil, ErrNotInSubgroup
 	}
-	c := new(big.Int).Exp(m, k.K, k.N)
-	return c.Bytes()
+	c := ctExp(m, k.K, k.N, k.group().exponentBitLen())
+	return c.Bytes(), nil
 }
 
-// Decrypt decrypts ciphertext.
-func (k *Key) Decrypt(ciphertext []byte) []byte {
+// Decrypt decrypts ciphertext. It returns ErrInvalidCiphertext if ciphertext
+// does not represent a number in the range [1,N). In subgroup mode, it returns
+// ErrNotInSubgroup if ciphertext is not in the subgroup of order Q. For
+// elliptic curves, it returns ErrNotOnCurve if ciphertext is not a point on the
+// curve.
+func (k *Key) Decrypt(ciphertext []byte) ([]byte, error) {
+	if k.curve() {
+		if err := k.params.checkPoint(ciphertext); err != nil {
+			return nil, err
+		}
+		return k.params.curveExp(ciphertext, k.L), nil
+	}
 	c := new(big.Int).SetBytes(ciphertext)
-	if c.Cmp(k.N) >= 0 {
-		panic("ciphertext is invalid")
+	if c.Sign() == 0 || c.Cmp(k.N) >= 0 {
+		return nil, ErrInvalidCiphertext
 	}
-	m := new(big.Int).Exp(c, k.L, k.N)
-	return m.Bytes()
+	if k.subgroup() && !k.params.inSubgroup(c) {
+		return nil, ErrNotInSubgroup
+	}
+	m := ctExp(c, k.L, k.N, k.group().exponentBitLen())
+	return m.Bytes(), nil
+}
+
+func (k *Key) subgroup() bool {
+	return k.params != nil && k.params.Subgroup
+}
+
+func (k *Key) curve() bool {
+	return k.params != nil && k.params.Curve != nil
 }
@@ -2,11 +2,15 @@ package sra
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"strconv"
 	"testing"
 	"time"
+
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
 )
 
 func TestGenerateKey(t *testing.T) {
@@ -22,14 +26,20 @@ func TestGenerateKey(t *testing.T) {
 		if i > minKeys && time.Since(start) > maxDuration {
 			break
 		}
-		key := GenerateKey(rand.Reader)
+		key, err := GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
 		kstr := key.K.String()
 		if _, ok := seen[kstr]; ok {
 			t.Fatalf("K already seen: %s (after %d iterations)", kstr, i)
 		}
 		seen[kstr] = struct{}{}
-		if key.N != defaultN {
-			t.Errorf("N = %v, want %v", key.N, defaultN)
+		if key.N != DefaultParams.N {
+			t.Errorf("N = %v, want %v", key.N, DefaultParams.N)
+		}
+		if key.Params() != DefaultParams {
+			t.Errorf("Params = %v, want %v", key.group().Name, DefaultParams.Name)
 		}
 		if key.K.BitLen() < minBitLen {
 			t.Errorf("K[=%v].BitLen() = %v, want >= %v", key.K, key.K.BitLen(), minBitLen)
@@ -40,14 +50,129 @@ func TestGenerateKey(t *testing.T) {
 	}
 }
 
+func TestGenerateKeyDeterministic(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP1024.RestrictToSubgroup(), P256} {
+		seed := []byte(params.Name)
+		k1, err := GenerateKeyWithParams(tiwerand.NewDeterministic(seed), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k2, err := GenerateKeyWithParams(tiwerand.NewDeterministic(seed), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k1.K.Cmp(k2.K) != 0 || k1.L.Cmp(k2.L) != 0 {
+			t.Errorf("%s: different keys from the same seed: %s, %s", params.Name, k1.Fingerprint(), k2.Fingerprint())
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048Q256, MODP2048, MODP3072} {
+		t.Run(params.Name, func(t *testing.T) {
+			if !params.N.ProbablyPrime(20) {
+				t.Errorf("N is not prime")
+			}
+			if !params.Q.ProbablyPrime(20) {
+				t.Errorf("Q is not prime")
+			}
+			// Q must divide the order of the multiplicative group.
+			r := new(big.Int).Sub(params.N, bigOne)
+			if r.Mod(r, params.Q).Sign() != 0 {
+				t.Errorf("Q does not divide N-1")
+			}
+			key := generateKey(t, params)
+			if key.Params() != params {
+				t.Errorf("Params = %v, want %v", key.group().Name, params.Name)
+			}
+			if got, want := key.K.BitLen(), params.ExpBitLen; got != want {
+				t.Errorf("K.BitLen() = %v, want %v", got, want)
+			}
+			plaintext := []byte("secret message")
+			if got := decrypt(t, key, encrypt(t, key, plaintext)); !eq(got, plaintext) {
+				t.Errorf("got %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestParamsEqual(t *testing.T) {
+	tests := []struct {
+		p, q *Params
+		want bool
+	}{
+		{MODP1024, MODP1024, true},
+		{MODP2048, MODP2048, true},
+		{MODP1024, MODP2048, false},
+		{MODP2048, MODP3072, false},
+		{MODP2048, &Params{N: MODP2048.N, Q: MODP2048.Q, G: MODP2048.G}, true},
+		{MODP2048, &Params{N: MODP2048.N, Q: MODP1024.Q, G: MODP2048.G}, false},
+		{MODP2048, &Params{N: MODP2048.N, Q: MODP2048.Q}, false},
+		{MODP2048, MODP2048.RestrictToSubgroup(), false},
+		{MODP2048.RestrictToSubgroup(), MODP2048.RestrictToSubgroup(), true},
+		{MODP2048, nil, false},
+		{nil, nil, true},
+	}
+	for i, tt := range tests {
+		if got := tt.p.Equal(tt.q); got != tt.want {
+			t.Errorf("#%d: Equal = %v, want %v", i, got, tt.want)
+		}
+		if tt.p == nil || tt.q == nil {
+			continue
+		}
+		if got := tt.p.ID() == tt.q.ID(); got != tt.want {
+			t.Errorf("#%d: ID() == ID(): got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestSubgroup(t *testing.T) {
+	for _, params := range []*Params{MODP1024, MODP2048} {
+		params := params.RestrictToSubgroup()
+		t.Run(params.Name, func(t *testing.T) {
+			key1 := generateKey(t, params)
+			key2 := generateKey(t, params)
+			for _, key := range []*Key{key1, key2} {
+				if key.K.Cmp(params.Q) >= 0 || key.L.Cmp(params.Q) >= 0 {
+					t.Errorf("exponents not reduced modulo Q")
+				}
+			}
+			plaintext, err := params.MapToSubgroup([]byte("secret message"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := encrypt(t, key2, encrypt(t, key1, plaintext))
+			if err := params.CheckCiphertext(buf); err != nil {
+				t.Error(err)
+			}
+			buf = decrypt(t, key2, decrypt(t, key1, buf))
+			if !eq(buf, plaintext) {
+				t.Errorf("got %x, want %x", buf, plaintext)
+			}
+
+			// N-1 has order 2, it is not in the subgroup.
+			order2 := new(big.Int).Sub(params.N, bigOne).Bytes()
+			if _, err := key1.Encrypt(order2); err != ErrNotInSubgroup {
+				t.Errorf("Encrypt: got error %v, want %v", err, ErrNotInSubgroup)
+			}
+			if _, err := key1.Decrypt(order2); err != ErrNotInSubgroup {
+				t.Errorf("Decrypt: got error %v, want %v", err, ErrNotInSubgroup)
+			}
+			if err := params.CheckCiphertext(order2); err != ErrNotInSubgroup {
+				t.Errorf("CheckCiphertext: got error %v, want %v", err, ErrNotInSubgroup)
+			}
+		})
+	}
+}
+
 func TestEncrytDecrypt(t *testing.T) {
 	plaintext := []byte("secret message")
-	key := GenerateKey(rand.Reader)
-	ciphertext := key.Encrypt(plaintext)
+	key := generateKey(t, DefaultParams)
+	ciphertext := encrypt(t, key, plaintext)
 	if string(ciphertext) == string(plaintext) {
 		t.Errorf("key.Encrypt: got plaintext")
 	}
-	recovered := key.Decrypt(ciphertext)
+	recovered := decrypt(t, key, ciphertext)
 	if got, want := string(recovered), string(plaintext); got != want {
 		t.Errorf("key.Decrypt: got %q, want %q", got, want)
 	}
@@ -55,9 +180,9 @@ func TestEncrytDecrypt(t *testing.T) {
 
 func TestCommutative(t *testing.T) {
 	plaintext := []byte("secret message")
-	key1 := GenerateKey(rand.Reader)
-	key2 := GenerateKey(rand.Reader)
-	key3 := GenerateKey(rand.Reader)
+	key1 := generateKey(t, DefaultParams)
+	key2 := generateKey(t, DefaultParams)
+	key3 := generateKey(t, DefaultParams)
 	perms := [][]*Key{
 		{key1, key2, key3},
 		{key1, key3, key2},
@@ -70,10 +195,10 @@ func TestCommutative(t *testing.T) {
 		for _, permDecryption := range perms {
 			buf := dup(plaintext)
 			for _, key := range permEncryption {
-				buf = key.Encrypt(buf)
+				buf = encrypt(t, key, buf)
 			}
 			for _, key := range permDecryption {
-				buf = key.Decrypt(buf)
+				buf = decrypt(t, key, buf)
 			}
 			if !eq(buf, plaintext) {
 				t.Fatalf("not commutative: got %q, want %q", buf, plaintext)
@@ -82,6 +207,84 @@ func TestCommutative(t *testing.T) {
 	}
 }
 
+func TestEncryptInvalid(t *testing.T) {
+	key := generateKey(t, MODP1024)
+	tests := []struct {
+		name      string
+		plaintext []byte
+		err       error
+	}{
+		{"empty", nil, ErrZeroMessage},
+		{"zero", []byte{0, 0}, ErrZeroMessage},
+		{"N", key.N.Bytes(), ErrMessageTooLarge},
+		{"too long", make([]byte, 1+len(key.N.Bytes())), ErrZeroMessage},
+		{"larger than N", append([]byte{1}, key.N.Bytes()...), ErrMessageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := key.Encrypt(tt.plaintext); err != tt.err {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecryptInvalid(t *testing.T) {
+	key := generateKey(t, MODP1024)
+	for _, ciphertext := range [][]byte{
+		nil,
+		{0},
+		key.N.Bytes(),
+		append([]byte{1}, key.N.Bytes()...),
+	} {
+		if _, err := key.Decrypt(ciphertext); err != ErrInvalidCiphertext {
+			t.Errorf("Decrypt(%x): got error %v, want %v", ciphertext, err, ErrInvalidCiphertext)
+		}
+		if err := key.Params().CheckCiphertext(ciphertext); err != ErrInvalidCiphertext {
+			t.Errorf("CheckCiphertext(%x): got error %v, want %v", ciphertext, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestGenerateKeyRandomError(t *testing.T) {
+	_, err := GenerateKey(errReader{io.ErrUnexpectedEOF})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// errReader is an io.Reader that always fails with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func generateKey(t testing.TB, params *Params) *Key {
+	t.Helper()
+	key, err := GenerateKeyWithParams(rand.Reader, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encrypt(t testing.TB, key *Key, plaintext []byte) []byte {
+	t.Helper()
+	ciphertext, err := key.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext
+}
+
+func decrypt(t testing.TB, key *Key, ciphertext []byte) []byte {
+	t.Helper()
+	plaintext, err := key.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
 func dup(src []byte) (dst []byte) {
 	dst = make([]byte, len(src))
 	copy(dst, src)
@@ -110,18 +313,16 @@ func BenchmarkExponentBitLen(b *testing.B) {
 		e.SetBit(e, 0, 1)
 		b.Run(strconv.FormatUint(uint64(bitLen), 10), func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				z.Exp(big.NewInt(int64(i)), e, defaultN)
+				z.Exp(big.NewInt(int64(i)), e, MODP1024.N)
 			}
 		})
 	}
 }
 
-// TODO: check quadratic residue
-
 func TestQuadraticResidues(t *testing.T) {
 	var r rune
 	for i, found := 0, 0; found < 106; i++ {
-		res := big.Jacobi(big.NewInt(int64(i)), defaultN)
+		res := big.Jacobi(big.NewInt(int64(i)), MODP1024.N)
 		r = ' '
 		if res == 1 {
 			r = '*'
@@ -0,0 +1,244 @@
+package sra
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// ErrInvalidShare is returned when a share of a decryption exponent does not
+// match the public commitments of its Sharing.
+var ErrInvalidShare = errors.New("sra: invalid share")
+
+// maxShareIndex is the largest index of a share holder.
+const maxShareIndex = 1 << 16
+
+// A Sharing is the public part of a Feldman verifiable secret sharing of the
+// decryption exponent L of a key. Holders of at least threshold shares can
+// jointly decrypt ciphertexts with L, see PartialDecrypt, without learning L.
+type Sharing struct {
+	// Commitments are G^a_j for the coefficients a_j of the polynomial
+	// used to compute shares, where a_0 = L and len(Commitments) is the
+	// threshold.
+	Commitments [][]byte
+	// Proof proves that Commitments[0] commits to the decryption exponent
+	// of the key committed to by Key.Commitment.
+	Proof []byte
+}
+
+const (
+	sharingProofLabel = "tiwe/sra sharing proof\x00"
+	partialProofLabel = "tiwe/sra partial decryption proof\x00"
+)
+
+// ShareDecryption splits the decryption exponent of k with Feldman verifiable
+// secret sharing, such that any threshold of the holders identified by indices
+// can decrypt with k, but fewer holders learn nothing about it. It returns the
+// public Sharing and one secret share per holder, in the order of indices.
+// Indices must be distinct and in the range [1,65536]. It requires subgroup
+// mode. If random is nil, crypto/rand.Reader is used.
+func (k *Key) ShareDecryption(random io.Reader, threshold int, indices []int) (*Sharing, [][]byte, error) {
+	commitment, err := k.Commitment()
+	if err != nil {
+		return nil, nil, err
+	}
+	if threshold < 1 || threshold > len(indices) {
+		return nil, nil, fmt.Errorf("sra: invalid threshold %d for %d holders", threshold, len(indices))
+	}
+	if err := checkIndices(indices); err != nil {
+		return nil, nil, err
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+	p := k.params
+	coeffs := make([]*big.Int, threshold)
+	coeffs[0] = k.L
+	for j := 1; j < threshold; j++ {
+		if coeffs[j], err = rand.Int(random, p.Q); err != nil {
+			return nil, nil, err
+		}
+	}
+	s := &Sharing{Commitments: make([][]byte, threshold)}
+	for j, a := range coeffs {
+		s.Commitments[j] = p.expSecret(p.generator(), a)
+	}
+	// G = y^L and Commitments[0] = G^L.
+	s.Proof, err = proveEqualLogs(p, random, sharingProofLabel, k.L, commitment, p.generator(), p.generator(), s.Commitments[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	shares := make([][]byte, len(indices))
+	for i, index := range indices {
+		// Horner's rule.
+		x := big.NewInt(int64(index))
+		v := new(big.Int)
+		for j := len(coeffs) - 1; j >= 0; j-- {
+			v.Mul(v, x)
+			v.Add(v, coeffs[j])
+			v.Mod(v, p.Q)
+		}
+		shares[i] = v.FillBytes(make([]byte, p.shareSize()))
+	}
+	return s, shares, nil
+}
+
+// VerifySharing verifies that s shares the decryption exponent of the key
+// committed to by commitment, with the given threshold. It returns
+// ErrInvalidProof if verification fails.
+func VerifySharing(params *Params, commitment []byte, s *Sharing, threshold int) error {
+	if !params.HasGenerator() {
+		return ErrNoGenerator
+	}
+	if len(s.Commitments) != threshold || params.CheckCiphertext(commitment) != nil {
+		return ErrInvalidProof
+	}
+	for _, c := range s.Commitments {
+		if params.CheckCiphertext(c) != nil {
+			return ErrInvalidProof
+		}
+	}
+	return verifyEqualLogs(params, sharingProofLabel, commitment, params.generator(), params.generator(), s.Commitments[0], s.Proof)
+}
+
+// VerifyShare returns ErrInvalidShare if share is not the share of the holder
+// with the given index. s must have been verified with VerifySharing.
+func VerifyShare(params *Params, s *Sharing, index int, share []byte) error {
+	v, ok := params.decodeShare(share)
+	if !ok || index < 1 || index > maxShareIndex {
+		return ErrInvalidShare
+	}
+	if string(params.exp(params.generator(), v)) != string(s.publicShare(params, index)) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+// publicShare returns G^share for the holder with the given index, computed
+// from the commitments as the product of Commitments[j]^(index^j).
+func (s *Sharing) publicShare(p *Params, index int) []byte {
+	x := big.NewInt(int64(index))
+	e := big.NewInt(1)
+	var y []byte
+	for _, c := range s.Commitments {
+		t := p.exp(c, e)
+		if y == nil {
+			y = t
+		} else {
+			y = p.mul(y, t)
+		}
+		e.Mul(e, x)
+		e.Mod(e, p.Q)
+	}
+	return y
+}
+
+// PartialDecrypt returns the partial decryption of ciphertext with share, and a
+// proof that it was computed with the share committed to in the Sharing. If
+// random is nil, crypto/rand.Reader is used.
+func PartialDecrypt(params *Params, random io.Reader, share, ciphertext []byte) (value, proof []byte, err error) {
+	if !params.HasGenerator() {
+		return nil, nil, ErrNoGenerator
+	}
+	v, ok := params.decodeShare(share)
+	if !ok {
+		return nil, nil, ErrInvalidShare
+	}
+	if err := params.CheckCiphertext(ciphertext); err != nil {
+		return nil, nil, err
+	}
+	value = params.expSecret(ciphertext, v)
+	y := params.expSecret(params.generator(), v)
+	proof, err = proveEqualLogs(params, random, partialProofLabel, v, params.generator(), y, ciphertext, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, proof, nil
+}
+
+// VerifyPartialDecryption verifies a proof created with PartialDecrypt by the
+// holder with the given index. It returns ErrInvalidProof if verification
+// fails.
+func VerifyPartialDecryption(params *Params, s *Sharing, index int, ciphertext, value, proof []byte) error {
+	if !params.HasGenerator() {
+		return ErrNoGenerator
+	}
+	if index < 1 || index > maxShareIndex {
+		return ErrInvalidProof
+	}
+	for _, x := range [][]byte{ciphertext, value} {
+		if params.CheckCiphertext(x) != nil {
+			return ErrInvalidProof
+		}
+	}
+	y := s.publicShare(params, index)
+	return verifyEqualLogs(params, partialProofLabel, params.generator(), y, ciphertext, value, proof)
+}
+
+// CombinePartialDecryptions returns the decryption of a ciphertext given its
+// verified partial decryptions by the holders with the given indices, as many
+// as the threshold of the Sharing.
+func CombinePartialDecryptions(params *Params, indices []int, values [][]byte) ([]byte, error) {
+	if len(indices) == 0 || len(indices) != len(values) {
+		return nil, fmt.Errorf("sra: got %d indices and %d values", len(indices), len(values))
+	}
+	if err := checkIndices(indices); err != nil {
+		return nil, err
+	}
+	var m []byte
+	for i, index := range indices {
+		t := params.exp(values[i], lagrange(params.Q, indices, index))
+		if m == nil {
+			m = t
+		} else {
+			m = params.mul(m, t)
+		}
+	}
+	return m, nil
+}
+
+// lagrange returns the Lagrange coefficient at zero for index among indices,
+// modulo q.
+func lagrange(q *big.Int, indices []int, index int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range indices {
+		if j == index {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(j)))
+		num.Mod(num, q)
+		den.Mul(den, big.NewInt(int64(j-index)))
+		den.Mod(den, q)
+	}
+	return num.Mul(num, den.ModInverse(den, q)).Mod(num, q)
+}
+
+// checkIndices checks that indices are distinct and in range.
+func checkIndices(indices []int) error {
+	seen := make(map[int]bool, len(indices))
+	for _, index := range indices {
+		if index < 1 || index > maxShareIndex {
+			return fmt.Errorf("sra: share index %d out of range", index)
+		}
+		if seen[index] {
+			return fmt.Errorf("sra: duplicate share index %d", index)
+		}
+		seen[index] = true
+	}
+	return nil
+}
+
+// shareSize returns the size in bytes of encoded shares.
+func (p *Params) shareSize() int {
+	return (p.Q.BitLen() + 7) / 8
+}
+
+func (p *Params) decodeShare(share []byte) (*big.Int, bool) {
+	if len(share) != p.shareSize() {
+		return nil, false
+	}
+	v := new(big.Int).SetBytes(share)
+	return v, v.Cmp(p.Q) < 0
+}
@@ -0,0 +1,108 @@
+package sra
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestThresholdDecryption(t *testing.T) {
+	for _, params := range []*Params{MODP1024.RestrictToSubgroup(), P256} {
+		t.Run(params.Name, func(t *testing.T) {
+			key := generateKey(t, params)
+			other := generateKey(t, params)
+			commitment, err := key.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherCommitment, err := other.Commitment()
+			if err != nil {
+				t.Fatal(err)
+			}
+			const threshold = 2
+			indices := []int{1, 3, 4}
+			s, shares, err := key.ShareDecryption(nil, threshold, indices)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifySharing(params, commitment, s, threshold); err != nil {
+				t.Fatalf("VerifySharing: %v", err)
+			}
+			if err := VerifySharing(params, otherCommitment, s, threshold); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("VerifySharing with other key: got error %v, want %v", err, ErrInvalidProof)
+			}
+			if err := VerifySharing(params, commitment, s, threshold+1); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("VerifySharing with other threshold: got error %v, want %v", err, ErrInvalidProof)
+			}
+			for i, index := range indices {
+				if err := VerifyShare(params, s, index, shares[i]); err != nil {
+					t.Errorf("VerifyShare(%d): %v", index, err)
+				}
+				if err := VerifyShare(params, s, index+1, shares[i]); !errors.Is(err, ErrInvalidShare) {
+					t.Errorf("VerifyShare(%d) with share of %d: got error %v, want %v", index+1, index, err, ErrInvalidShare)
+				}
+			}
+
+			plaintext, err := params.MapToSubgroup([]byte{42})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ciphertext := encrypt(t, key, encrypt(t, other, plaintext))
+			want := decrypt(t, key, ciphertext)
+			values := make([][]byte, len(indices))
+			for i, index := range indices {
+				var proof []byte
+				values[i], proof, err = PartialDecrypt(params, nil, shares[i], ciphertext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := VerifyPartialDecryption(params, s, index, ciphertext, values[i], proof); err != nil {
+					t.Errorf("VerifyPartialDecryption(%d): %v", index, err)
+				}
+				if err := VerifyPartialDecryption(params, s, index, ciphertext, want, proof); !errors.Is(err, ErrInvalidProof) {
+					t.Errorf("VerifyPartialDecryption(%d) of wrong value: got error %v, want %v", index, err, ErrInvalidProof)
+				}
+			}
+			// Any threshold of holders can decrypt.
+			for _, pair := range [][2]int{{0, 1}, {0, 2}, {2, 1}} {
+				got, err := CombinePartialDecryptions(params,
+					[]int{indices[pair[0]], indices[pair[1]]},
+					[][]byte{values[pair[0]], values[pair[1]]})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !eq(params.fixedElement(got), params.fixedElement(want)) {
+					t.Errorf("holders %v: got %x, want %x", pair, got, want)
+				}
+			}
+			// A single holder cannot.
+			got, err := CombinePartialDecryptions(params, indices[:1], values[:1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eq(params.fixedElement(got), params.fixedElement(want)) {
+				t.Errorf("single holder decrypted below the threshold")
+			}
+		})
+	}
+}
+
+func TestShareDecryptionInvalid(t *testing.T) {
+	key := generateKey(t, MODP1024.RestrictToSubgroup())
+	for _, tt := range []struct {
+		threshold int
+		indices   []int
+	}{
+		{0, []int{1, 2}},
+		{3, []int{1, 2}},
+		{1, []int{0, 1}},
+		{1, []int{1, 1}},
+		{1, []int{maxShareIndex + 1}},
+	} {
+		if _, _, err := key.ShareDecryption(nil, tt.threshold, tt.indices); err == nil {
+			t.Errorf("ShareDecryption(%d, %v): got nil error", tt.threshold, tt.indices)
+		}
+	}
+	if _, _, err := generateKey(t, MODP1024).ShareDecryption(nil, 1, []int{1}); !errors.Is(err, ErrNoGenerator) {
+		t.Errorf("without subgroup: got error %v, want %v", err, ErrNoGenerator)
+	}
+}
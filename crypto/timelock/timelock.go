@@ -0,0 +1,142 @@
+// Package timelock implements time-lock puzzles, as described by Rivest, Shamir
+// and Wagner in "Time-lock puzzles and timed-release crypto" (1996).
+//
+// A message is locked with a key derived from 2^(2^T) mod N, where N is the
+// product of two random primes. Whoever knows the factors of N computes the key
+// quickly, but anyone else must perform T sequential squarings modulo N, which
+// cannot be parallelized. A player can thus publish a message that others can
+// read after a predictable amount of work, even if the player never reveals it.
+package timelock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ModulusBits is the size of the modulus of puzzles created by Lock.
+const ModulusBits = 2048
+
+// Limits on puzzles accepted by Solve.
+const (
+	maxModulusBits = 4096
+	maxDataSize    = 1 << 16
+)
+
+// ErrInvalidPuzzle is returned by Solve for malformed puzzles.
+var ErrInvalidPuzzle = errors.New("timelock: invalid puzzle")
+
+// A Puzzle is a message locked for T sequential squarings.
+type Puzzle struct {
+	// N is the modulus, big-endian.
+	N []byte
+	// T is the number of squarings needed to unlock the message.
+	T uint64
+	// Data is the locked message.
+	Data []byte
+}
+
+var two = big.NewInt(2)
+
+// Lock returns a puzzle that unlocks msg after t squarings. If random is nil,
+// crypto/rand.Reader is used.
+func Lock(random io.Reader, msg []byte, t uint64) (*Puzzle, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	if len(msg) > maxDataSize {
+		return nil, errors.New("timelock: message too long")
+	}
+	var p, q *big.Int
+	for {
+		var err error
+		if p, err = prime(random, ModulusBits/2); err != nil {
+			return nil, err
+		}
+		if q, err = prime(random, ModulusBits/2); err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) != 0 {
+			break
+		}
+	}
+	n := new(big.Int).Mul(p, q)
+	// With phi = (p-1)(q-1), 2^(2^t) = 2^(2^t mod phi) mod n.
+	phi := new(big.Int).Mul(p.Sub(p, big.NewInt(1)), q.Sub(q, big.NewInt(1)))
+	e := new(big.Int).Exp(two, new(big.Int).SetUint64(t), phi)
+	y := new(big.Int).Exp(two, e, n)
+	puzzle := &Puzzle{N: n.Bytes(), T: t}
+	puzzle.Data = puzzle.xor(y, msg)
+	return puzzle, nil
+}
+
+// prime returns a random prime of the given size, a multiple of 8, reading
+// only from random. Unlike crypto/rand.Prime, it uses deterministic sources
+// as given, such that games can be replayed.
+func prime(random io.Reader, bits int) (*big.Int, error) {
+	b := make([]byte, bits/8)
+	p := new(big.Int)
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+		// Set the top two bits, such that the product of two primes
+		// has exactly twice as many bits, and make it odd.
+		b[0] |= 0xc0
+		b[len(b)-1] |= 1
+		if p.SetBytes(b).ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+// Solve unlocks the message of p by performing p.T sequential squarings. It
+// returns ctx.Err() if ctx is canceled before the puzzle is solved.
+func (p *Puzzle) Solve(ctx context.Context) ([]byte, error) {
+	n := new(big.Int).SetBytes(p.N)
+	if n.BitLen() > maxModulusBits || n.Cmp(two) <= 0 || n.Bit(0) == 0 || len(p.Data) > maxDataSize {
+		return nil, ErrInvalidPuzzle
+	}
+	y := new(big.Int).Set(two)
+	for i := uint64(0); i < p.T; i++ {
+		if i%(1<<12) == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		y.Mul(y, y)
+		y.Mod(y, n)
+	}
+	return p.xor(y, p.Data), nil
+}
+
+// xor returns data XOR the keystream derived from the solution y of p.
+func (p *Puzzle) xor(y *big.Int, data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/timelock\x00"))
+	var b [8]byte
+	for _, x := range [][]byte{p.N, y.Bytes()} {
+		binary.BigEndian.PutUint64(b[:], uint64(len(x)))
+		h.Write(b[:])
+		h.Write(x)
+	}
+	binary.BigEndian.PutUint64(b[:], p.T)
+	h.Write(b[:])
+	xof, _ := blake2b.NewXOF(uint32(len(data)), h.Sum(nil))
+	out := make([]byte, len(data))
+	if _, err := io.ReadFull(xof, out); err != nil {
+		panic(err)
+	}
+	for i := range out {
+		out[i] ^= data[i]
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package timelock
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
+)
+
+func TestLock(t *testing.T) {
+	msg := []byte("the secret")
+	p, err := Lock(nil, msg, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(p.Data, msg) {
+		t.Errorf("puzzle data %x contains the message", p.Data)
+	}
+	got, err := p.Solve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("Solve() = %q, want %q", got, msg)
+	}
+
+	// Fewer squarings do not unlock the message.
+	p.T--
+	if got, err := p.Solve(context.Background()); err != nil || bytes.Equal(got, msg) {
+		t.Errorf("Solve() with T-1 = %q, %v; want other message", got, err)
+	}
+}
+
+func TestLockDeterministic(t *testing.T) {
+	p1, err := Lock(tiwerand.NewDeterministic([]byte("seed")), []byte("msg"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := Lock(tiwerand.NewDeterministic([]byte("seed")), []byte("msg"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p1.N, p2.N) || !bytes.Equal(p1.Data, p2.Data) {
+		t.Errorf("puzzles from the same seed differ")
+	}
+}
+
+func TestSolveCanceled(t *testing.T) {
+	p, err := Lock(nil, []byte("msg"), 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Solve(ctx); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSolveInvalid(t *testing.T) {
+	for _, p := range []*Puzzle{
+		{N: nil, T: 1},
+		{N: []byte{2}, T: 1},
+		{N: []byte{0x10, 0}, T: 1},
+		{N: make([]byte, maxModulusBits/8+1), T: 1},
+	} {
+		if p.N != nil && len(p.N) > 1 {
+			p.N[0] |= 1
+		}
+		if _, err := p.Solve(context.Background()); err != ErrInvalidPuzzle {
+			t.Errorf("Solve() of N=%x: got error %v, want %v", p.N, err, ErrInvalidPuzzle)
+		}
+	}
+}
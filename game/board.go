@@ -1,5 +1,7 @@
 package game
 
+import "fmt"
+
 type Board [][]Tile
 
 func (b Board) Valid() bool {
@@ -12,46 +14,149 @@ func (b Board) Valid() bool {
 }
 
 func isRun(set []Tile) bool {
-	if len(set) < 3 {
-		return false
+	_, ok := runStart(set)
+	return ok
+}
+
+// runStart returns the value of the first tile of set if it is a run, with
+// jokers standing in for any missing tiles.
+func runStart(set []Tile) (uint64, bool) {
+	if len(set) < 3 || len(set) > MaxValue {
+		return 0, false
 	}
-	for i := 0; i < len(set)-1; i++ {
-		if set[i+1].Value-set[i].Value != 1 {
-			return false
+	var start uint64
+	var color Color
+	for i, t := range set {
+		if t.IsJoker() {
+			continue
 		}
-		if set[i].Color != set[i+1].Color {
-			return false
+		if start == 0 {
+			if t.Value <= uint64(i) {
+				return 0, false
+			}
+			start, color = t.Value-uint64(i), t.Color
+			continue
+		}
+		if t.Value != start+uint64(i) || t.Color != color {
+			return 0, false
 		}
 	}
-	return true
+	if start == 0 || start+uint64(len(set))-1 > MaxValue {
+		return 0, false
+	}
+	return start, true
 }
 
 func isGroup(set []Tile) bool {
-	if len(set) < 3 {
-		return false
+	_, ok := groupValue(set)
+	return ok
+}
+
+// groupValue returns the value of the tiles of set if it is a group, with
+// jokers standing in for tiles of any missing colors.
+func groupValue(set []Tile) (uint64, bool) {
+	if len(set) < 3 || len(set) > NumColors {
+		return 0, false
 	}
+	var value uint64
 	var seen int64
-	for i := 0; i < len(set)-1; i++ {
-		if set[i].Value != set[i+1].Value {
-			return false
+	for _, t := range set {
+		if t.IsJoker() {
+			continue
 		}
-		seen |= 1 << set[i].Color
-		if (seen>>set[i+1].Color)&1 == 1 {
-			return false
+		if value == 0 {
+			value = t.Value
 		}
+		if t.Value != value || t.Value > MaxValue || t.Color >= NumColors || (seen>>t.Color)&1 == 1 {
+			return 0, false
+		}
+		seen |= 1 << t.Color
 	}
-	return true
+	return value, value != 0
+}
+
+// Represents returns the tiles that the joker at index i of set may stand for:
+// the missing tile of a run, or a tile of any missing color of a group. A set
+// with a single numbered tile and two jokers may be either. Represents returns
+// nil if set is not a valid set, or if set[i] is not a joker.
+func Represents(set []Tile, i int) []Tile {
+	if i < 0 || i >= len(set) || !set[i].IsJoker() {
+		return nil
+	}
+	var tiles []Tile
+	if start, ok := runStart(set); ok {
+		for _, t := range set {
+			if !t.IsJoker() {
+				tiles = append(tiles, Tile{Value: start + uint64(i), Color: t.Color})
+				break
+			}
+		}
+	}
+	if value, ok := groupValue(set); ok {
+		for c := Color(0); c < NumColors; c++ {
+			missing := true
+			for _, t := range set {
+				if !t.IsJoker() && t.Color == c {
+					missing = false
+				}
+			}
+			if missing {
+				tiles = append(tiles, Tile{Value: value, Color: c})
+			}
+		}
+	}
+	return tiles
+}
+
+// Retrieve returns a copy of b in which the joker at index i of set s is
+// replaced with t, a tile from the hand of the player, which must be a tile
+// that the joker stands for. The player takes the joker, which they must play
+// again in the same turn.
+func (b Board) Retrieve(s, i int, t Tile) (Board, error) {
+	if s < 0 || s >= len(b) {
+		return nil, fmt.Errorf("game: no set %d on the board", s)
+	}
+	if i < 0 || i >= len(b[s]) || !b[s][i].IsJoker() {
+		return nil, fmt.Errorf("game: no joker at %d in set %d", i, s)
+	}
+	match := false
+	for _, r := range Represents(b[s], i) {
+		if r == t {
+			match = true
+		}
+	}
+	if !match {
+		return nil, fmt.Errorf("game: joker at %d in set %d does not stand for %v", i, s, t)
+	}
+	set := append([]Tile(nil), b[s]...)
+	set[i] = t
+	if !isRun(set) && !isGroup(set) {
+		return nil, fmt.Errorf("game: replacing joker at %d in set %d with %v breaks the set", i, s, t)
+	}
+	nb := append(Board(nil), b...)
+	nb[s] = set
+	return nb, nil
 }
 
 func (b Board) Add(ts ...Tile) Board {
 	return append(b, ts)
 }
 
+// A Tile is a numbered tile, with Value from 1 to MaxValue, or a joker, with
+// Value 0 and any Color.
 type Tile struct {
 	Value uint64
 	Color
 }
 
+// Joker is the canonical joker tile.
+var Joker = Tile{}
+
+// IsJoker reports whether t is a joker.
+func (t Tile) IsJoker() bool {
+	return t.Value == 0
+}
+
 type Color uint64
 
 const (
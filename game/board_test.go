@@ -1,6 +1,9 @@
 package game
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestBoardValid(t *testing.T) {
 	tests := []struct {
@@ -40,6 +43,56 @@ func TestBoardValid(t *testing.T) {
 			board: Board{}.Add(Tile{7, Red}, Tile{7, Green}, Tile{7, Red}),
 			valid: false,
 		},
+		{
+			name:  "groups must not contain more than 4 tiles",
+			board: Board{}.Add(Tile{7, Red}, Tile{7, Green}, Tile{7, Blue}, Tile{7, Yellow}, Joker),
+			valid: false,
+		},
+		{
+			name:  "runs must not go beyond 13",
+			board: Board{}.Add(Tile{12, Red}, Tile{13, Red}, Tile{14, Red}),
+			valid: false,
+		},
+		{
+			name:  "groups must not go beyond 13",
+			board: Board{}.Add(Tile{14, Red}, Tile{14, Green}, Tile{14, Blue}),
+			valid: false,
+		},
+		{
+			name:  "jokers stand for missing tiles in runs",
+			board: Board{}.Add(Tile{2, Red}, Joker, Tile{4, Red}),
+			valid: true,
+		},
+		{
+			name:  "jokers stand for tiles at the ends of runs",
+			board: Board{}.Add(Joker, Tile{2, Blue}, Tile{3, Blue}, Joker),
+			valid: true,
+		},
+		{
+			name:  "jokers do not stand for tiles before 1",
+			board: Board{}.Add(Joker, Tile{1, Blue}, Tile{2, Blue}),
+			valid: false,
+		},
+		{
+			name:  "jokers do not stand for tiles after 13",
+			board: Board{}.Add(Tile{12, Blue}, Tile{13, Blue}, Joker),
+			valid: false,
+		},
+		{
+			name:  "jokers do not fill gaps of more than one tile",
+			board: Board{}.Add(Tile{2, Red}, Joker, Tile{5, Red}),
+			valid: false,
+		},
+		{
+			name:  "jokers stand for missing colors in groups",
+			board: Board{}.Add(Tile{7, Red}, Joker, Tile{7, Blue}, Joker),
+			valid: true,
+		},
+		{
+			name:  "sets must contain a numbered tile",
+			board: Board{}.Add(Joker, Joker, Joker),
+			valid: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -49,3 +102,90 @@ func TestBoardValid(t *testing.T) {
 		})
 	}
 }
+
+func TestRepresents(t *testing.T) {
+	tests := []struct {
+		name string
+		set  []Tile
+		i    int
+		want []Tile
+	}{
+		{
+			name: "inside a run",
+			set:  []Tile{{2, Red}, Joker, {4, Red}},
+			i:    1,
+			want: []Tile{{3, Red}},
+		},
+		{
+			name: "at the end of a run",
+			set:  []Tile{{2, Red}, {3, Red}, {4, Red}, Joker},
+			i:    3,
+			want: []Tile{{5, Red}},
+		},
+		{
+			name: "in a group",
+			set:  []Tile{{7, Red}, Joker, {7, Blue}},
+			i:    1,
+			want: []Tile{{7, Green}, {7, Yellow}},
+		},
+		{
+			name: "run or group",
+			set:  []Tile{Joker, Joker, {5, Yellow}},
+			i:    0,
+			want: []Tile{{3, Yellow}, {5, Red}, {5, Green}, {5, Blue}},
+		},
+		{
+			name: "not a joker",
+			set:  []Tile{{2, Red}, Joker, {4, Red}},
+			i:    0,
+		},
+		{
+			name: "invalid set",
+			set:  []Tile{{2, Red}, Joker, {5, Red}},
+			i:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Represents(tt.set, tt.i); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoardRetrieve(t *testing.T) {
+	b := Board{}.
+		Add(Tile{2, Red}, Joker, Tile{4, Red}).
+		Add(Tile{7, Red}, Tile{7, Green}, Tile{7, Blue}, Joker)
+	got, err := b.Retrieve(0, 1, Tile{3, Red})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Board{}.
+		Add(Tile{2, Red}, Tile{3, Red}, Tile{4, Red}).
+		Add(Tile{7, Red}, Tile{7, Green}, Tile{7, Blue}, Joker)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !b[0][1].IsJoker() {
+		t.Error("Retrieve modified the original board")
+	}
+	if _, err := b.Retrieve(1, 3, Tile{7, Yellow}); err != nil {
+		t.Error(err)
+	}
+
+	for _, tt := range []struct {
+		s, i int
+		t    Tile
+	}{
+		{0, 1, Tile{3, Green}},
+		{0, 0, Tile{2, Red}},
+		{1, 3, Tile{7, Red}},
+		{2, 0, Tile{3, Red}},
+	} {
+		if _, err := b.Retrieve(tt.s, tt.i, tt.t); err == nil {
+			t.Errorf("Retrieve(%d, %d, %v): got nil error", tt.s, tt.i, tt.t)
+		}
+	}
+}
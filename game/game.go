@@ -1,12 +1,188 @@
 package game
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"math/rand"
 
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
+)
+
+// Rules of the game.
+const (
+	// MinPlayers and MaxPlayers bound the number of players in a game.
+	MinPlayers = 2
+	MaxPlayers = 4
+	// HandSize is the number of tiles dealt to each player.
+	HandSize = 14
+	// MaxValue is the highest value of a numbered tile.
+	MaxValue = 13
+	// NumColors is the number of tile colors.
+	NumColors = 4
+	// NumTiles is the number of tiles in the standard set.
+	NumTiles = 2 * (MaxValue*NumColors + 1)
+)
+
+// ErrEmptyPool is returned when drawing from an empty pool.
+var ErrEmptyPool = errors.New("game: pool is empty")
+
+// A Game is a plain in-memory game engine, in which the faces of all tiles are
+// known. It is a reference for the rules, and a model of the state that the
+// distributed protocol keeps with concealed tiles, see package state.
 type Game struct {
 	Players []string
-	Pool
-	Table
-	Hands map[string][]Tile
+	Board   Board
+	Hands   map[string][]Tile
+	// Rules are the rules of the game, DefaultRules unless changed before
+	// the first move.
+	Rules Rules
+
+	pool   []Tile          // undrawn tiles, drawn from the end
+	melded map[string]bool // players who made their initial meld
+	passed map[string]bool // players who passed since the last move
+}
+
+// New returns a game for the named players, with the standard set shuffled and
+// HandSize tiles dealt to each player. It panics if the number of players is
+// not between MinPlayers and MaxPlayers, or if names repeat.
+func New(name ...string) *Game {
+	return newGame(tiwerand.Rand, name...)
+}
+
+// newGame is like New, shuffling the tiles with r.
+func newGame(r *rand.Rand, name ...string) *Game {
+	checkPlayers(name)
+	g := &Game{
+		Players: append([]string(nil), name...),
+		Hands:   make(map[string][]Tile, len(name)),
+		Rules:   DefaultRules,
+		pool:    TileSet(),
+		melded:  make(map[string]bool, len(name)),
+		passed:  make(map[string]bool, len(name)),
+	}
+	r.Shuffle(len(g.pool), func(i, j int) {
+		g.pool[i], g.pool[j] = g.pool[j], g.pool[i]
+	})
+	for _, player := range g.Players {
+		g.Hands[player] = append([]Tile(nil), g.pool[len(g.pool)-HandSize:]...)
+		g.pool = g.pool[:len(g.pool)-HandSize]
+	}
+	return g
+}
+
+// checkPlayers panics if the number of players is not between MinPlayers and
+// MaxPlayers, or if names repeat.
+func checkPlayers(name []string) {
+	if len(name) < MinPlayers || len(name) > MaxPlayers {
+		panic(fmt.Sprintf("game: got %d players, want %d to %d", len(name), MinPlayers, MaxPlayers))
+	}
+	seen := make(map[string]bool, len(name))
+	for _, player := range name {
+		if seen[player] {
+			panic(fmt.Sprintf("game: repeated player %q", player))
+		}
+		seen[player] = true
+	}
+}
+
+// TileSet returns the standard set of NumTiles tiles: two copies of every
+// value from 1 to MaxValue in every color, and two jokers.
+func TileSet() []Tile {
+	tiles := make([]Tile, 0, NumTiles)
+	for copies := 0; copies < 2; copies++ {
+		for c := Color(0); c < NumColors; c++ {
+			for v := uint64(1); v <= MaxValue; v++ {
+				tiles = append(tiles, Tile{Value: v, Color: c})
+			}
+		}
+		tiles = append(tiles, Joker)
+	}
+	return tiles
+}
+
+// Draw moves a tile from the pool to the hand of player, and returns it. It
+// returns ErrEmptyPool if there are no tiles left, and ErrOver if the round is
+// over.
+func (g *Game) Draw(player string) (Tile, error) {
+	hand, ok := g.Hands[player]
+	if !ok {
+		return Tile{}, fmt.Errorf("game: unknown player %q", player)
+	}
+	if g.Over() {
+		return Tile{}, ErrOver
+	}
+	if len(g.pool) == 0 {
+		return Tile{}, ErrEmptyPool
+	}
+	t := g.pool[len(g.pool)-1]
+	g.pool = g.pool[:len(g.pool)-1]
+	g.Hands[player] = append(hand, t)
+	return t, nil
+}
+
+// Hand returns a copy of the tiles in the hand of player, or nil if there is
+// no such player.
+func (g *Game) Hand(player string) []Tile {
+	hand, ok := g.Hands[player]
+	if !ok {
+		return nil
+	}
+	return append([]Tile{}, hand...)
+}
+
+// Play replaces the board with after, the board at the end of a turn of
+// player, and removes the tiles they played from their hand. It returns the
+// played tiles, or an error if the turn is not valid, see Rules.ValidateTurn.
+// It returns ErrOver if the round is over.
+func (g *Game) Play(player string, after Board) ([]Tile, error) {
+	hand, ok := g.Hands[player]
+	if !ok {
+		return nil, fmt.Errorf("game: unknown player %q", player)
+	}
+	if g.Over() {
+		return nil, ErrOver
+	}
+	played, err := g.Rules.ValidateTurn(g.Board, after, hand, g.melded[player])
+	if err != nil {
+		return nil, err
+	}
+	g.melded[player] = true
+	g.passed = make(map[string]bool, len(g.Players))
+	g.Hands[player] = removeTiles(hand, played)
+	g.Board = make(Board, len(after))
+	for i, set := range after {
+		g.Board[i] = append([]Tile(nil), set...)
+	}
+	return played, nil
+}
+
+// Melded reports whether player made their initial meld.
+func (g *Game) Melded(player string) bool {
+	return g.melded[player]
+}
+
+// removeTiles returns a copy of hand without tiles, which must all be in
+// hand.
+func removeTiles(hand, tiles []Tile) []Tile {
+	remove := make(map[Tile]int)
+	for _, t := range tiles {
+		remove[t.face()]++
+	}
+	var rest []Tile
+	for _, t := range hand {
+		if remove[t.face()] > 0 {
+			remove[t.face()]--
+			continue
+		}
+		rest = append(rest, t)
+	}
+	return rest
+}
+
+// PoolSize returns the number of tiles left in the pool.
+func (g *Game) PoolSize() int {
+	return len(g.pool)
 }
 
 // A Pool is a collection of tiles whose faces are unknown to all players.
@@ -22,31 +198,123 @@ type Run []Tile
 
 type Group []Tile
 
+// Errors returned by ConcealedTile.
+var (
+	// ErrSealed is returned when revealing a tile that is still sealed
+	// with some key.
+	ErrSealed = errors.New("game: tile is sealed")
+	// ErrIncompatibleKey is returned when sealing or opening a tile with a
+	// key whose parameters differ from the keys used before.
+	ErrIncompatibleKey = errors.New("game: key parameters differ from the tile's")
+)
+
+// A TileCodec encodes tiles as plaintexts of a commutative encryption scheme,
+// see package tilecode.
+type TileCodec interface {
+	EncodeTile(t Tile) []byte
+	DecodeTile(b []byte) (Tile, error)
+}
+
 // A ConcealedTile represents a Tile whose face value is concealed to one or
 // more players.
 type ConcealedTile struct {
+	codec  TileCodec
+	data   []byte
+	params *[32]byte           // ID of the parameters of all keys
+	sealed map[string]struct{} // fingerprints of keys sealing the tile
+}
+
+// Conceal returns a ConcealedTile holding the encoding of t, not sealed with
+// any key yet.
+func Conceal(codec TileCodec, t Tile) *ConcealedTile {
+	return Sealed(codec, codec.EncodeTile(t))
+}
+
+// Sealed returns a ConcealedTile holding data, the encoding of a tile sealed
+// with the keys with the given fingerprints, typically keys of other players.
+func Sealed(codec TileCodec, data []byte, fingerprints ...string) *ConcealedTile {
+	ct := &ConcealedTile{
+		codec:  codec,
+		data:   data,
+		sealed: make(map[string]struct{}, len(fingerprints)),
+	}
+	for _, fp := range fingerprints {
+		ct.sealed[fp] = struct{}{}
+	}
+	return ct
+}
+
+// Bytes returns the current encrypted encoding of the tile.
+func (ct *ConcealedTile) Bytes() []byte {
+	return ct.data
 }
 
 // Seal encrypts the tile with one or more secret keys. It is okay to call Seal
 // multiple times. Sealing with the same key more than once has the same effect
-// as sealing once.
-func (ct *ConcealedTile) Seal(keys ...[]byte) {
-
+// as sealing once. All keys must have the same parameters.
+func (ct *ConcealedTile) Seal(keys ...commutative.Key) error {
+	for _, key := range keys {
+		if err := ct.checkParams(key); err != nil {
+			return err
+		}
+		fp := key.Fingerprint()
+		if _, ok := ct.sealed[fp]; ok {
+			continue
+		}
+		data, err := key.Encrypt(ct.data)
+		if err != nil {
+			return err
+		}
+		ct.data = data
+		ct.sealed[fp] = struct{}{}
+	}
+	return nil
 }
 
 // Open decrypts the tile with one of more secret keys. It is okay to call Open
 // multiple times. Calling Open with a key that is innefective is a no-op.
-func (ct *ConcealedTile) Open(keys ...[]byte) {
+func (ct *ConcealedTile) Open(keys ...commutative.Key) error {
+	for _, key := range keys {
+		fp := key.Fingerprint()
+		if _, ok := ct.sealed[fp]; !ok {
+			continue
+		}
+		if err := ct.checkParams(key); err != nil {
+			return err
+		}
+		data, err := key.Decrypt(ct.data)
+		if err != nil {
+			return err
+		}
+		ct.data = data
+		delete(ct.sealed, fp)
+	}
+	return nil
+}
 
+// checkParams checks that key has the same parameters as the keys used before.
+func (ct *ConcealedTile) checkParams(key commutative.Key) error {
+	id := key.Params().ID()
+	if ct.params == nil {
+		ct.params = &id
+		return nil
+	}
+	if *ct.params != id {
+		return ErrIncompatibleKey
+	}
+	return nil
 }
 
 // Tile returns a Tile if and only if the ConcealedTile can be revealed. To
 // reveal a ConcealedTile, call Open with the same keys used to seal it, in any
 // order.
 func (ct *ConcealedTile) Tile() (*Tile, error) {
-	return nil, errors.New("could not reveal tile")
-}
-
-func New(name ...string) *Game {
-	return nil
+	if len(ct.sealed) > 0 {
+		return nil, ErrSealed
+	}
+	t, err := ct.codec.DecodeTile(ct.data)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
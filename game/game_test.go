@@ -1,11 +1,16 @@
 package game
 
 import (
+	"errors"
 	"log"
 	"math/rand"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
 )
 
 type Message struct {
@@ -38,3 +43,168 @@ func TestGame(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestTileSet(t *testing.T) {
+	tiles := TileSet()
+	if len(tiles) != NumTiles {
+		t.Fatalf("got %d tiles, want %d", len(tiles), NumTiles)
+	}
+	count := make(map[Tile]int)
+	for _, tile := range tiles {
+		count[tile]++
+	}
+	for tile, n := range count {
+		if n != 2 {
+			t.Errorf("tile %v appears %d times, want 2", tile, n)
+		}
+	}
+	if n := count[Joker]; n != 2 {
+		t.Errorf("got %d jokers, want 2", n)
+	}
+}
+
+func TestNew(t *testing.T) {
+	names := []string{"Alice", "Bob", "Carol"}
+	g := newGame(tiwerand.NewDeterministic([]byte(t.Name())), names...)
+	if !reflect.DeepEqual(g.Players, names) {
+		t.Errorf("players %v, want %v", g.Players, names)
+	}
+	if want := NumTiles - len(names)*HandSize; g.PoolSize() != want {
+		t.Errorf("pool has %d tiles, want %d", g.PoolSize(), want)
+	}
+	// Hands and pool together form the standard set.
+	count := make(map[Tile]int)
+	for _, name := range names {
+		hand := g.Hand(name)
+		if len(hand) != HandSize {
+			t.Errorf("%s: got %d tiles, want %d", name, len(hand), HandSize)
+		}
+		for _, tile := range hand {
+			count[tile]++
+		}
+	}
+	for _, tile := range g.pool {
+		count[tile]++
+	}
+	want := make(map[Tile]int)
+	for _, tile := range TileSet() {
+		want[tile]++
+	}
+	if !reflect.DeepEqual(count, want) {
+		t.Errorf("hands and pool do not form the standard set:\ngot  %v\nwant %v", count, want)
+	}
+	// Tiles are shuffled.
+	if reflect.DeepEqual(g.pool, TileSet()[:g.PoolSize()]) {
+		t.Error("pool is not shuffled")
+	}
+	if g.Hand("Dave") != nil {
+		t.Error("got hand of unknown player")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := [][]string{
+		{"Alice"},
+		{"Alice", "Bob", "Carol", "Dave", "Eve"},
+		{"Alice", "Bob", "Alice"},
+	}
+	for _, names := range tests {
+		t.Run(strings.Join(names, ","), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("got no panic")
+				}
+			}()
+			New(names...)
+		})
+	}
+}
+
+func TestDraw(t *testing.T) {
+	g := New("Alice", "Bob")
+	hand := g.Hand("Alice")
+	for n := g.PoolSize(); n > 0; n-- {
+		tile, err := g.Draw("Alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hand = append(hand, tile)
+		if g.PoolSize() != n-1 {
+			t.Fatalf("pool has %d tiles after draw, want %d", g.PoolSize(), n-1)
+		}
+	}
+	if !reflect.DeepEqual(g.Hand("Alice"), hand) {
+		t.Errorf("hand does not contain drawn tiles")
+	}
+	if len(g.Hand("Bob")) != HandSize {
+		t.Errorf("hand of other player changed")
+	}
+	if _, err := g.Draw("Bob"); err != ErrEmptyPool {
+		t.Errorf("got error %v, want %v", err, ErrEmptyPool)
+	}
+	if _, err := g.Draw("Carol"); err == nil {
+		t.Error("drawing for unknown player: got nil error")
+	}
+}
+
+func TestHandCopy(t *testing.T) {
+	g := New("Alice", "Bob")
+	hand := g.Hand("Alice")
+	hand[0] = Tile{Value: 99}
+	if g.Hand("Alice")[0] == hand[0] {
+		t.Error("modifying the result of Hand changed the hand")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	g := New("Alice", "Bob")
+	g.Hands["Alice"] = []Tile{{9, Red}, {9, Blue}, {10, Red}, {11, Red}}
+	if g.Melded("Alice") {
+		t.Error("melded before playing")
+	}
+	after := Board{}.Add(Tile{9, Red}, Tile{10, Red}, Tile{11, Red})
+	played, err := g.Play("Alice", after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Melded("Alice") {
+		t.Error("not melded after playing")
+	}
+	if want := after[0]; !reflect.DeepEqual(played, want) {
+		t.Errorf("played %v, want %v", played, want)
+	}
+	if want := []Tile{{9, Blue}}; !reflect.DeepEqual(g.Hand("Alice"), want) {
+		t.Errorf("hand %v, want %v", g.Hand("Alice"), want)
+	}
+	if !reflect.DeepEqual(g.Board, after) {
+		t.Errorf("board %v, want %v", g.Board, after)
+	}
+	after[0][0] = Tile{1, Red}
+	if g.Board[0][0] != (Tile{9, Red}) {
+		t.Error("modifying the board played changed the game")
+	}
+
+	if _, err := g.Play("Alice", Board{}); !errors.Is(err, ErrTileRemoved) {
+		t.Errorf("got error %v, want %v", err, ErrTileRemoved)
+	}
+	if _, err := g.Play("Carol", g.Board); err == nil {
+		t.Error("playing as unknown player: got nil error")
+	}
+
+	// Tiles on the board do not count for the initial meld of Bob, and
+	// cannot be rearranged until after it.
+	g.Hands["Bob"] = []Tile{{12, Red}, {13, Red}, {10, Blue}, {11, Blue}, {12, Blue}}
+	extended := Board{}.Add(Tile{9, Red}, Tile{10, Red}, Tile{11, Red}, Tile{12, Red}, Tile{13, Red})
+	if _, err := g.Play("Bob", extended); !errors.Is(err, ErrInitialMeld) {
+		t.Errorf("got error %v, want %v", err, ErrInitialMeld)
+	}
+	g.Rules.InitialMeld = 33
+	meld := append(Board{}.Add(Tile{10, Blue}, Tile{11, Blue}, Tile{12, Blue}), g.Board...)
+	if _, err := g.Play("Bob", meld); err != nil {
+		t.Fatal(err)
+	}
+	extended = append(Board{extended[0]}, meld[0])
+	if _, err := g.Play("Bob", extended); err != nil {
+		t.Errorf("extending sets after the initial meld: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package game
+
+import "errors"
+
+// Errors returned when starting a round of a match.
+var (
+	// ErrMatchOver is returned when starting a round of a match that is
+	// over.
+	ErrMatchOver = errors.New("game: match is over")
+	// ErrNoEnd is returned when starting a round of a match with neither
+	// Rounds nor Target, which would never be over.
+	ErrNoEnd = errors.New("game: match has neither Rounds nor Target")
+)
+
+// A Match is a series of rounds among the same players, whose scores
+// accumulate. The match is over after Rounds rounds, or after the round in
+// which a player reaches Target points, whichever comes first. At least one
+// of Rounds and Target must be positive.
+type Match struct {
+	Players []string
+	// Rules are the rules of every round.
+	Rules  Rules
+	Rounds int
+	Target int
+	// Totals maps every player to the sum of their scores.
+	Totals map[string]int
+	// Results are the outcomes of the rounds played, in order.
+	Results []*Result
+
+	playing *Game // round in play
+}
+
+// NewMatch returns a match for the named players, with DefaultRules and no
+// rounds played. Rounds or Target must be set before the first round. It
+// panics if the number of players is not between MinPlayers and MaxPlayers, or
+// if names repeat.
+func NewMatch(name ...string) *Match {
+	checkPlayers(name)
+	m := &Match{
+		Players: append([]string(nil), name...),
+		Rules:   DefaultRules,
+		Totals:  make(map[string]int, len(name)),
+	}
+	for _, player := range name {
+		m.Totals[player] = 0
+	}
+	return m
+}
+
+// NewRound returns a new game for the next round. It returns ErrMatchOver if
+// the match is over, ErrNotOver if the previous round was not recorded, and
+// ErrNoEnd if neither Rounds nor Target is positive.
+func (m *Match) NewRound() (*Game, error) {
+	if m.Rounds <= 0 && m.Target <= 0 {
+		return nil, ErrNoEnd
+	}
+	if m.Over() {
+		return nil, ErrMatchOver
+	}
+	if m.playing != nil {
+		return nil, ErrNotOver
+	}
+	g := New(m.Players...)
+	g.Rules = m.Rules
+	m.playing = g
+	return g, nil
+}
+
+// Record adds the result of the round in play to the totals. It returns
+// ErrNotOver if the round is not over.
+func (m *Match) Record() (*Result, error) {
+	if m.playing == nil {
+		return nil, errors.New("game: no round in play")
+	}
+	r, err := m.playing.Result()
+	if err != nil {
+		return nil, err
+	}
+	for player, score := range r.Scores {
+		m.Totals[player] += score
+	}
+	m.Results = append(m.Results, r)
+	m.playing = nil
+	return r, nil
+}
+
+// Over reports whether the match is over.
+func (m *Match) Over() bool {
+	if m.Rounds > 0 && len(m.Results) >= m.Rounds {
+		return true
+	}
+	if m.Target > 0 {
+		for _, total := range m.Totals {
+			if total >= m.Target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Leaders returns the players with the highest total, in the order of
+// Players.
+func (m *Match) Leaders() []string {
+	var leaders []string
+	for _, player := range m.Players {
+		switch {
+		case len(leaders) == 0 || m.Totals[player] > m.Totals[leaders[0]]:
+			leaders = []string{player}
+		case m.Totals[player] == m.Totals[leaders[0]]:
+			leaders = append(leaders, player)
+		}
+	}
+	return leaders
+}
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// winRound plays a round of m in which winner empties their hand, and the
+// other players keep a hand with the given penalty.
+func winRound(t *testing.T, m *Match, winner string, penalty uint64) *Result {
+	t.Helper()
+	g, err := m.NewRound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, player := range g.Players {
+		g.Hands[player] = []Tile{{penalty, Blue}}
+	}
+	set := []Tile{{11, Red}, {12, Red}, {13, Red}}
+	g.Hands[winner] = set
+	if _, err := m.Record(); err != ErrNotOver {
+		t.Fatalf("recording a round in play: got error %v, want %v", err, ErrNotOver)
+	}
+	if _, err := g.Play(winner, Board{}.Add(set...)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestMatchRounds(t *testing.T) {
+	m := NewMatch("Alice", "Bob", "Carol")
+	if _, err := m.NewRound(); err != ErrNoEnd {
+		t.Fatalf("match without end: got error %v, want %v", err, ErrNoEnd)
+	}
+	m.Rounds = 2
+	winRound(t, m, "Alice", 5)
+	if m.Over() {
+		t.Fatal("over after 1 of 2 rounds")
+	}
+	winRound(t, m, "Bob", 7)
+	if !m.Over() {
+		t.Fatal("not over after 2 of 2 rounds")
+	}
+	want := map[string]int{"Alice": 10 - 7, "Bob": -5 + 14, "Carol": -5 - 7}
+	if !reflect.DeepEqual(m.Totals, want) {
+		t.Errorf("totals %v, want %v", m.Totals, want)
+	}
+	if len(m.Results) != 2 {
+		t.Errorf("got %d results, want 2", len(m.Results))
+	}
+	if got, want := m.Leaders(), []string{"Bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("leaders %v, want %v", got, want)
+	}
+	if _, err := m.NewRound(); err != ErrMatchOver {
+		t.Errorf("got error %v, want %v", err, ErrMatchOver)
+	}
+}
+
+func TestMatchTarget(t *testing.T) {
+	m := NewMatch("Alice", "Bob")
+	m.Target = 25
+	m.Rules.InitialMeld = 36
+	for i := 1; !m.Over(); i++ {
+		if i > 3 {
+			t.Fatal("not over after reaching the target")
+		}
+		r := winRound(t, m, "Alice", 10)
+		if r.Scores["Alice"] != 10 {
+			t.Fatalf("round %d: Alice scored %d, want 10", i, r.Scores["Alice"])
+		}
+	}
+	if len(m.Results) != 3 {
+		t.Errorf("over after %d rounds, want 3", len(m.Results))
+	}
+	if got, want := m.Leaders(), []string{"Alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("leaders %v, want %v", got, want)
+	}
+}
+
+func TestMatchNewRoundInPlay(t *testing.T) {
+	m := NewMatch("Alice", "Bob")
+	m.Rounds = 1
+	if _, err := m.Record(); err == nil {
+		t.Error("recording before the first round: got nil error")
+	}
+	if _, err := m.NewRound(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.NewRound(); err != ErrNotOver {
+		t.Errorf("got error %v, want %v", err, ErrNotOver)
+	}
+	if got, want := m.Leaders(), []string{"Alice", "Bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("leaders %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rules are the configurable rules of a game.
+type Rules struct {
+	// InitialMeld is the minimum number of points of the first move of
+	// each player, see Points. The initial meld must be made of new sets
+	// of tiles from the hand of the player, without changing the sets on
+	// the board.
+	InitialMeld int
+}
+
+// DefaultRules are the rules used by New.
+var DefaultRules = Rules{InitialMeld: 30}
+
+// ErrInitialMeld is returned by Rules.ValidateTurn for a first move that
+// breaks the initial meld rule.
+var ErrInitialMeld = errors.New("game: invalid initial meld")
+
+// ValidateTurn is like the function ValidateTurn, and also enforces the
+// initial meld rule if the player has not melded yet.
+func (r Rules) ValidateTurn(before, after Board, hand []Tile, melded bool) ([]Tile, error) {
+	played, err := ValidateTurn(before, after, hand)
+	if err != nil || melded {
+		return played, err
+	}
+	// Sets on the board before must be on the board after unchanged, in
+	// any order. The other sets are new.
+	old := make(map[string]int)
+	for _, set := range before {
+		old[setKey(set)]++
+	}
+	points := 0
+	for _, set := range after {
+		if k := setKey(set); old[k] > 0 {
+			old[k]--
+			continue
+		}
+		points += Points(set)
+	}
+	for _, n := range old {
+		if n > 0 {
+			return nil, fmt.Errorf("%w: sets on the board changed", ErrInitialMeld)
+		}
+	}
+	if points < r.InitialMeld {
+		return nil, fmt.Errorf("%w: got %d points, want %d or more", ErrInitialMeld, points, r.InitialMeld)
+	}
+	return played, nil
+}
+
+// setKey returns a key identifying the tiles of set, in order.
+func setKey(set []Tile) string {
+	faces := make([]Tile, len(set))
+	for i, t := range set {
+		faces[i] = t.face()
+	}
+	return fmt.Sprint(faces)
+}
+
+// Points returns the sum of the values of the tiles of a valid set, where each
+// joker is worth the value of the tile it stands for. A set with a single
+// numbered tile and two jokers, which may be either a run or a group, is worth
+// the most of both. Points returns 0 if set is not valid.
+func Points(set []Tile) int {
+	points := 0
+	if start, ok := runStart(set); ok {
+		n := len(set)
+		points = n*int(start) + n*(n-1)/2
+	}
+	if value, ok := groupValue(set); ok && len(set)*int(value) > points {
+		points = len(set) * int(value)
+	}
+	return points
+}
@@ -0,0 +1,121 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPoints(t *testing.T) {
+	tests := []struct {
+		set  []Tile
+		want int
+	}{
+		{[]Tile{{9, Red}, {10, Red}, {11, Red}}, 30},
+		{[]Tile{{7, Red}, {7, Green}, {7, Blue}, {7, Yellow}}, 28},
+		{[]Tile{{9, Red}, Joker, {11, Red}}, 30},
+		{[]Tile{Joker, {12, Blue}, {13, Blue}}, 36},
+		{[]Tile{{10, Red}, Joker, {10, Blue}}, 30},
+		// Run of 3, 4 and 5, or group of 5.
+		{[]Tile{Joker, Joker, {5, Yellow}}, 15},
+		// Run of 5, 6 and 7, or group of 5.
+		{[]Tile{{5, Yellow}, Joker, Joker}, 18},
+		{[]Tile{{9, Red}, {11, Red}}, 0},
+	}
+	for _, tt := range tests {
+		if got := Points(tt.set); got != tt.want {
+			t.Errorf("Points(%v) = %d, want %d", tt.set, got, tt.want)
+		}
+	}
+}
+
+func TestRulesValidateTurn(t *testing.T) {
+	run := []Tile{{1, Blue}, {2, Blue}, {3, Blue}}
+	tests := []struct {
+		name   string
+		rules  Rules
+		before Board
+		after  Board
+		hand   []Tile
+		melded bool
+		err    error
+	}{
+		{
+			name:   "enough points",
+			rules:  DefaultRules,
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(Tile{10, Red}, Tile{10, Green}, Tile{10, Blue}).Add(run...),
+			hand:   []Tile{{10, Red}, {10, Green}, {10, Blue}},
+		},
+		{
+			name:  "enough points in several sets",
+			rules: DefaultRules,
+			after: Board{}.
+				Add(Tile{4, Red}, Tile{4, Green}, Tile{4, Blue}).
+				Add(Tile{5, Yellow}, Tile{6, Yellow}, Tile{7, Yellow}),
+			hand: []Tile{{4, Red}, {4, Green}, {4, Blue}, {5, Yellow}, {6, Yellow}, {7, Yellow}},
+		},
+		{
+			name:  "joker counts as the tile it stands for",
+			rules: DefaultRules,
+			after: Board{}.Add(Tile{9, Red}, Joker, Tile{11, Red}),
+			hand:  []Tile{{9, Red}, Joker, {11, Red}},
+		},
+		{
+			name:  "too few points",
+			rules: DefaultRules,
+			after: Board{}.Add(Tile{9, Red}, Tile{9, Green}, Tile{9, Blue}),
+			hand:  []Tile{{9, Red}, {9, Green}, {9, Blue}},
+			err:   ErrInitialMeld,
+		},
+		{
+			name:  "configured threshold",
+			rules: Rules{InitialMeld: 27},
+			after: Board{}.Add(Tile{9, Red}, Tile{9, Green}, Tile{9, Blue}),
+			hand:  []Tile{{9, Red}, {9, Green}, {9, Blue}},
+		},
+		{
+			name:   "tiles on the board do not count",
+			rules:  DefaultRules,
+			before: Board{}.Add(Tile{11, Red}, Tile{12, Red}, Tile{13, Red}),
+			after:  Board{}.Add(Tile{10, Red}, Tile{11, Red}, Tile{12, Red}, Tile{13, Red}),
+			hand:   []Tile{{10, Red}},
+			err:    ErrInitialMeld,
+		},
+		{
+			name:   "sets on the board cannot be rearranged",
+			rules:  Rules{},
+			before: Board{}.Add(Tile{1, Red}, Tile{2, Red}, Tile{3, Red}, Tile{4, Red}, Tile{5, Red}, Tile{6, Red}),
+			after: Board{}.
+				Add(Tile{1, Red}, Tile{2, Red}, Tile{3, Red}).
+				Add(Tile{4, Red}, Tile{5, Red}, Tile{6, Red}).
+				Add(Tile{12, Red}, Tile{12, Green}, Tile{12, Blue}),
+			hand: []Tile{{12, Red}, {12, Green}, {12, Blue}},
+			err:  ErrInitialMeld,
+		},
+		{
+			name:   "after the initial meld",
+			rules:  DefaultRules,
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(append(append([]Tile(nil), run...), Tile{4, Blue})...),
+			hand:   []Tile{{4, Blue}},
+			melded: true,
+		},
+		{
+			name:   "invalid turn",
+			rules:  DefaultRules,
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(run...),
+			hand:   []Tile{{4, Blue}},
+			melded: true,
+			err:    ErrNoTilePlayed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rules.ValidateTurn(tt.before, tt.after, tt.hand, tt.melded)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
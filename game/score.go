@@ -0,0 +1,115 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// JokerPenalty is the penalty of a joker left in hand at the end of a round.
+const JokerPenalty = 30
+
+// Errors returned at the end of a round.
+var (
+	// ErrMustDraw is returned when passing while the pool has tiles.
+	ErrMustDraw = errors.New("game: must draw while the pool has tiles")
+	// ErrNotOver is returned for the result of a round still in play.
+	ErrNotOver = errors.New("game: round is not over")
+	// ErrOver is returned for a move in a round that is over.
+	ErrOver = errors.New("game: round is over")
+)
+
+// A Result is the outcome of a round.
+type Result struct {
+	// Winner is the player who emptied their hand, or, if the round is
+	// blocked, the player with the lowest penalty.
+	Winner string
+	// Blocked reports whether the round ended because the pool is empty
+	// and no player could play.
+	Blocked bool
+	// Scores maps every player to their score in the round. Every other
+	// player loses their penalty minus the penalty of the winner, which
+	// is zero unless the round is blocked, and the winner gains what the
+	// others lose.
+	Scores map[string]int
+}
+
+// Penalty returns the sum of the values of tiles left in a hand, where each
+// joker is worth JokerPenalty.
+func Penalty(hand []Tile) int {
+	penalty := 0
+	for _, t := range hand {
+		if t.IsJoker() {
+			penalty += JokerPenalty
+		} else {
+			penalty += int(t.Value)
+		}
+	}
+	return penalty
+}
+
+// Pass records that player could not play when the pool is empty. It returns
+// ErrMustDraw if there are tiles left to draw, and ErrOver if the round is
+// over.
+func (g *Game) Pass(player string) error {
+	if _, ok := g.Hands[player]; !ok {
+		return fmt.Errorf("game: unknown player %q", player)
+	}
+	if g.Over() {
+		return ErrOver
+	}
+	if len(g.pool) > 0 {
+		return ErrMustDraw
+	}
+	g.passed[player] = true
+	return nil
+}
+
+// Winner returns the player who emptied their hand, or "" if there is none.
+func (g *Game) Winner() string {
+	for _, player := range g.Players {
+		if len(g.Hands[player]) == 0 {
+			return player
+		}
+	}
+	return ""
+}
+
+// Blocked reports whether the pool is empty and every player passed since the
+// last move, such that nobody can play.
+func (g *Game) Blocked() bool {
+	return len(g.pool) == 0 && len(g.passed) == len(g.Players)
+}
+
+// Over reports whether the round is over, because a player won or the game is
+// blocked.
+func (g *Game) Over() bool {
+	return g.Winner() != "" || g.Blocked()
+}
+
+// Result returns the outcome of the round, or ErrNotOver if it is not over.
+// In a blocked round, ties for the lowest penalty go to the player first in
+// Players.
+func (g *Game) Result() (*Result, error) {
+	r := &Result{Winner: g.Winner(), Scores: make(map[string]int, len(g.Players))}
+	if r.Winner == "" {
+		if !g.Blocked() {
+			return nil, ErrNotOver
+		}
+		r.Blocked = true
+		for _, player := range g.Players {
+			if r.Winner == "" || Penalty(g.Hands[player]) < Penalty(g.Hands[r.Winner]) {
+				r.Winner = player
+			}
+		}
+	}
+	base := Penalty(g.Hands[r.Winner])
+	for _, player := range g.Players {
+		if player == r.Winner {
+			continue
+		}
+		score := Penalty(g.Hands[player]) - base
+		r.Scores[player] = -score
+		r.Scores[r.Winner] += score
+	}
+	return r, nil
+}
@@ -0,0 +1,113 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPenalty(t *testing.T) {
+	hand := []Tile{{1, Red}, {13, Blue}, Joker, {7, Yellow}}
+	if got, want := Penalty(hand), 1+13+JokerPenalty+7; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	if got := Penalty(nil); got != 0 {
+		t.Errorf("empty hand: got %d, want 0", got)
+	}
+}
+
+func TestResultWin(t *testing.T) {
+	g := New("Alice", "Bob", "Carol")
+	g.Hands["Alice"] = []Tile{{10, Red}, {11, Red}, {12, Red}}
+	g.Hands["Bob"] = []Tile{{1, Red}, Joker}
+	g.Hands["Carol"] = []Tile{{5, Green}, {6, Green}}
+	if g.Over() {
+		t.Fatal("over before the last tile is played")
+	}
+	if _, err := g.Result(); err != ErrNotOver {
+		t.Fatalf("got error %v, want %v", err, ErrNotOver)
+	}
+	if _, err := g.Play("Alice", Board{}.Add(g.Hands["Alice"]...)); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Over() || g.Winner() != "Alice" {
+		t.Fatalf("got winner %q, want Alice", g.Winner())
+	}
+	if _, err := g.Play("Bob", Board{}.Add(Tile{10, Red}, Tile{11, Red}, Tile{12, Red})); err != ErrOver {
+		t.Errorf("playing after the round is over: got error %v, want %v", err, ErrOver)
+	}
+	if _, err := g.Draw("Bob"); err != ErrOver {
+		t.Errorf("drawing after the round is over: got error %v, want %v", err, ErrOver)
+	}
+	r, err := g.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Result{
+		Winner: "Alice",
+		Scores: map[string]int{"Alice": 31 + 11, "Bob": -31, "Carol": -11},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+}
+
+func TestResultBlocked(t *testing.T) {
+	g := New("Alice", "Bob", "Carol")
+	if err := g.Pass("Alice"); err != ErrMustDraw {
+		t.Fatalf("passing with tiles in the pool: got error %v, want %v", err, ErrMustDraw)
+	}
+	g.pool = nil
+	g.Hands["Alice"] = []Tile{{9, Red}, {3, Blue}}
+	g.Hands["Bob"] = []Tile{{2, Red}, {4, Blue}}
+	g.Hands["Carol"] = []Tile{Joker}
+	for _, player := range []string{"Alice", "Bob"} {
+		if err := g.Pass(player); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g.Over() {
+		t.Fatal("blocked before every player passed")
+	}
+	if err := g.Pass("Carol"); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Blocked() || !g.Over() {
+		t.Fatal("not blocked after every player passed")
+	}
+	if err := g.Pass("Alice"); err != ErrOver {
+		t.Errorf("passing after the round is over: got error %v, want %v", err, ErrOver)
+	}
+	r, err := g.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Result{
+		Winner:  "Bob",
+		Blocked: true,
+		Scores:  map[string]int{"Alice": -6, "Bob": 6 + 24, "Carol": -24},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+	if err := g.Pass("Dave"); err == nil {
+		t.Error("passing as unknown player: got nil error")
+	}
+}
+
+func TestPassResetByPlay(t *testing.T) {
+	g := New("Alice", "Bob")
+	g.pool = nil
+	g.Hands["Alice"] = []Tile{{10, Red}, {11, Red}, {12, Red}, {1, Blue}}
+	if err := g.Pass("Bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Play("Alice", Board{}.Add(Tile{10, Red}, Tile{11, Red}, Tile{12, Red})); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Pass("Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Blocked() {
+		t.Error("blocked although a player played since Bob passed")
+	}
+}
@@ -0,0 +1,182 @@
+// Package tilecode encodes tiles as SRA plaintexts.
+//
+// SRA encryption preserves the Legendre symbol of a message modulo N, so the
+// symbol of any ciphertext is observable by all players. To avoid leaking
+// information about tiles, every tile is encoded as a quadratic residue modulo
+// N, and, consequently, all ciphertexts have the same symbol.
+//
+// A tile is encoded as h^((N-1)/Q) mod N, an element of the subgroup of order
+// Q, where h is a hash of the tile face and copy expanded to an integer below
+// N. Since (N-1)/Q is even, the encoding is a quadratic residue. For safe
+// primes, the encoding is simply h². Tiles are decoded by table lookup.
+//
+// Encodings must not be small integers: encryption is multiplicative, so that
+// E(a)·E(b) = E(ab) under any key, and any known relation between encodings,
+// such as 2²·3² = 6², would hold between the ciphertexts of a shuffled pool
+// and identify tiles. No relation between hashes is known.
+//
+// For elliptic curve parameters, such as sra.P256, h is hashed to a point on
+// the curve instead, see sra.Params.MapToSubgroup. Every point is a valid
+// plaintext and there is no symbol to leak.
+package tilecode
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Errors returned when decoding or checking encoded tiles.
+var (
+	// ErrNotResidue is returned for a value that is not a quadratic residue
+	// modulo N, and thus cannot be an encoded tile or a ciphertext of one.
+	ErrNotResidue = errors.New("tilecode: not a quadratic residue")
+	// ErrUnknownTile is returned for a quadratic residue that does not
+	// encode any tile.
+	ErrUnknownTile = errors.New("tilecode: unknown tile")
+)
+
+// numFaces is the number of distinct tile faces: every value in every color,
+// plus the joker. Every face exists in two copies in the set.
+const numFaces = game.NumTiles / 2
+
+// A Codec encodes tiles as plaintexts for a given set of SRA parameters.
+type Codec struct {
+	params *sra.Params
+	deck   [][]byte
+	tiles  map[string]game.Tile
+}
+
+// New returns a Codec for keys using params.
+func New(params *sra.Params) *Codec {
+	c := &Codec{
+		params: params,
+		deck:   make([][]byte, game.NumTiles),
+		tiles:  make(map[string]game.Tile, game.NumTiles),
+	}
+	for i := range c.deck {
+		b, err := params.MapToSubgroup(hashTile(params.N, i%numFaces, i/numFaces))
+		if err != nil {
+			panic("tilecode: " + err.Error())
+		}
+		c.deck[i] = b
+		c.tiles[string(b)] = face(i % numFaces)
+	}
+	return c
+}
+
+// hashTile returns an integer in the range [1,N) derived from copy j of the
+// tile face with index i, hashing them together with a counter with
+// BLAKE2b-512 until the digest, truncated to the bit length of N, is in range
+// (try-and-increment). Blocks for successive counters are concatenated to
+// cover N.
+func hashTile(n *big.Int, i, j int) []byte {
+	size := (n.BitLen() + 7) / 8
+	excess := uint(8*size - n.BitLen())
+	for ctr := 0; ; ctr++ {
+		var buf []byte
+		for block := 0; len(buf) < size; block++ {
+			h, _ := blake2b.New512(nil)
+			h.Write([]byte("tiwe/tilecode tile\x00"))
+			h.Write([]byte{byte(len(n.Bytes()) >> 8), byte(len(n.Bytes()))})
+			h.Write(n.Bytes())
+			h.Write([]byte{byte(i), byte(j), byte(ctr >> 8), byte(ctr), byte(block)})
+			buf = h.Sum(buf)
+		}
+		buf = buf[:size]
+		buf[0] &= 0xff >> excess
+		x := new(big.Int).SetBytes(buf)
+		if x.Sign() > 0 && x.Cmp(n) < 0 {
+			return buf
+		}
+	}
+}
+
+// face returns the tile face with the given index. Index 0 is the joker,
+// represented by a Tile with Value 0.
+func face(i int) game.Tile {
+	if i == 0 {
+		return game.Tile{}
+	}
+	i--
+	return game.Tile{Value: uint64(i/game.NumColors + 1), Color: game.Color(i % game.NumColors)}
+}
+
+// faceIndex is the inverse of face. It returns -1 if t is not a valid tile.
+func faceIndex(t game.Tile) int {
+	if t.Value == 0 {
+		return 0
+	}
+	if t.Value > game.MaxValue || t.Color >= game.NumColors {
+		return -1
+	}
+	return int(t.Value-1)*game.NumColors + int(t.Color) + 1
+}
+
+// EncodeTile returns the encoding of t. Every tile face exists in two copies in
+// the deck, EncodeTile returns the encoding of the first copy. It panics if t
+// is not a valid tile. Jokers are represented with Value 0 and any Color.
+func (c *Codec) EncodeTile(t game.Tile) []byte {
+	i := faceIndex(t)
+	if i < 0 {
+		panic("tilecode: invalid tile")
+	}
+	return dup(c.deck[i])
+}
+
+// Deck returns the encodings of all game.NumTiles tiles. Tiles with the same
+// face have distinct encodings, such that all ciphertexts in a pool are
+// distinct.
+func (c *Codec) Deck() [][]byte {
+	deck := make([][]byte, len(c.deck))
+	for i, b := range c.deck {
+		deck[i] = dup(b)
+	}
+	return deck
+}
+
+// DecodeTile returns the tile encoded in b.
+func (c *Codec) DecodeTile(b []byte) (game.Tile, error) {
+	if t, ok := c.tiles[string(b)]; ok {
+		return t, nil
+	}
+	if err := c.Check(b); err != nil {
+		return game.Tile{}, err
+	}
+	return game.Tile{}, ErrUnknownTile
+}
+
+// Check returns ErrNotResidue if b, an encoded tile or a ciphertext of one, is
+// not a quadratic residue modulo N. For elliptic curve parameters, it returns
+// sra.ErrNotOnCurve if b is not a point on the curve.
+func (c *Codec) Check(b []byte) error {
+	if c.params.Curve != nil {
+		return c.params.CheckCiphertext(b)
+	}
+	x := new(big.Int).SetBytes(b)
+	if x.Sign() == 0 || x.Cmp(c.params.N) >= 0 || big.Jacobi(x, c.params.N) != 1 {
+		return ErrNotResidue
+	}
+	return nil
+}
+
+var defaultCodec = New(sra.DefaultParams)
+
+// EncodeTile returns the encoding of t for keys using sra.DefaultParams.
+func EncodeTile(t game.Tile) []byte {
+	return defaultCodec.EncodeTile(t)
+}
+
+// DecodeTile returns the tile encoded in b for keys using sra.DefaultParams.
+func DecodeTile(b []byte) (game.Tile, error) {
+	return defaultCodec.DecodeTile(b)
+}
+
+func dup(src []byte) (dst []byte) {
+	dst = make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
@@ -0,0 +1,189 @@
+package tilecode
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+var allParams = []*sra.Params{
+	sra.MODP1024,
+	sra.MODP2048,
+	sra.MODP3072,
+	sra.MODP1024.RestrictToSubgroup(),
+	sra.P256,
+}
+
+func TestDeck(t *testing.T) {
+	for _, params := range allParams {
+		t.Run(params.Name, func(t *testing.T) {
+			c := New(params)
+			deck := c.Deck()
+			if len(deck) != game.NumTiles {
+				t.Fatalf("len(deck) = %d, want %d", len(deck), game.NumTiles)
+			}
+			seen := make(map[string]bool)
+			count := make(map[game.Tile]int)
+			for i, b := range deck {
+				if seen[string(b)] {
+					t.Errorf("tile %d: duplicate encoding %x", i, b)
+				}
+				seen[string(b)] = true
+				if err := c.Check(b); err != nil {
+					t.Errorf("tile %d: %v", i, err)
+				}
+				// Encoded tiles must be valid in subgroup mode.
+				if err := params.RestrictToSubgroup().CheckCiphertext(b); err != nil {
+					t.Errorf("tile %d: %v", i, err)
+				}
+				tile, err := c.DecodeTile(b)
+				if err != nil {
+					t.Fatalf("tile %d: %v", i, err)
+				}
+				count[tile]++
+			}
+			if len(count) != numFaces {
+				t.Errorf("got %d faces, want %d", len(count), numFaces)
+			}
+			for tile, n := range count {
+				if n != 2 {
+					t.Errorf("tile %v appears %d times, want 2", tile, n)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for v := uint64(0); v <= game.MaxValue; v++ {
+		for _, color := range []game.Color{game.Red, game.Green, game.Blue, game.Yellow} {
+			tile := game.Tile{Value: v, Color: color}
+			got, err := DecodeTile(EncodeTile(tile))
+			if err != nil {
+				t.Fatalf("%v: %v", tile, err)
+			}
+			want := tile
+			if v == 0 {
+				// Jokers have no color.
+				want = game.Tile{}
+			}
+			if got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	for _, tile := range []game.Tile{{Value: game.MaxValue + 1}, {Value: 1, Color: game.NumColors}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("EncodeTile(%v) did not panic", tile)
+				}
+			}()
+			EncodeTile(tile)
+		}()
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	n := sra.DefaultParams.N
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"empty", nil, ErrNotResidue},
+		{"N", n.Bytes(), ErrNotResidue},
+		// N ≡ 3 (mod 4), therefore -1 is not a quadratic residue.
+		{"N-1", new(big.Int).Sub(n, big.NewInt(1)).Bytes(), ErrNotResidue},
+		{"one", []byte{1}, ErrUnknownTile},
+		{"square of large number", big.NewInt(1000 * 1000).Bytes(), ErrUnknownTile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeTile(tt.b); err != tt.err {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestCiphertextSymbols shows that the Legendre symbol of ciphertexts does not
+// reveal any tile attribute, because it is the same for all tiles.
+func TestCiphertextSymbols(t *testing.T) {
+	for _, params := range allParams[:2] {
+		t.Run(params.Name, func(t *testing.T) {
+			key, err := sra.GenerateKeyWithParams(rand.Reader, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := New(params)
+			for i, b := range c.Deck() {
+				ciphertext, err := key.Encrypt(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				x := new(big.Int).SetBytes(ciphertext)
+				if s := big.Jacobi(x, params.N); s != 1 {
+					tile, _ := c.DecodeTile(b)
+					t.Errorf("tile %d (%v): symbol = %d, want 1", i, tile, s)
+				}
+			}
+		})
+	}
+}
+
+// TestNaiveEncodingLeaks shows that, unlike Codec, encoding tiles as small
+// integers would leak information through the Legendre symbol.
+func TestNaiveEncodingLeaks(t *testing.T) {
+	n := sra.DefaultParams.N
+	symbols := make(map[int]bool)
+	for i := 2; i < game.NumTiles+2; i++ {
+		symbols[big.Jacobi(big.NewInt(int64(i)), n)] = true
+	}
+	if len(symbols) < 2 {
+		t.Errorf("naive encoding produced a single symbol")
+	}
+}
+
+// TestDeckRelations shows that no product or square of two encoded tiles is
+// another encoded tile. Since encryption is multiplicative, such a relation
+// would also hold between the ciphertexts of a shuffled pool under any key.
+func TestDeckRelations(t *testing.T) {
+	for _, params := range allParams {
+		t.Run(params.Name, func(t *testing.T) {
+			c := New(params)
+			deck := c.Deck()
+			index := make(map[string]int, len(deck))
+			for i, b := range deck {
+				index[string(b)] = i
+			}
+			for i := range deck {
+				for j := i; j < len(deck); j++ {
+					if k, ok := index[string(mul(params, deck[i], deck[j]))]; ok {
+						t.Errorf("tile %d · tile %d = tile %d", i, j, k)
+					}
+				}
+			}
+		})
+	}
+}
+
+// mul returns the product of the group elements a and b.
+func mul(params *sra.Params, a, b []byte) []byte {
+	if params.Curve != nil {
+		ax, ay := elliptic.UnmarshalCompressed(params.Curve, a)
+		bx, by := elliptic.UnmarshalCompressed(params.Curve, b)
+		x, y := params.Curve.Add(ax, ay, bx, by)
+		return elliptic.MarshalCompressed(params.Curve, x, y)
+	}
+	x := new(big.Int).SetBytes(a)
+	x.Mul(x, new(big.Int).SetBytes(b))
+	return x.Mod(x, params.N).Bytes()
+}
@@ -0,0 +1,87 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by ValidateTurn.
+var (
+	// ErrInvalidBoard is returned when the board after a turn has sets that
+	// are neither runs nor groups.
+	ErrInvalidBoard = errors.New("game: board has invalid sets")
+	// ErrTileRemoved is returned when a tile on the board before a turn is
+	// missing after it.
+	ErrTileRemoved = errors.New("game: tile removed from the board")
+	// ErrJokerNotReused is returned when a joker retrieved from the board
+	// is not played again in the same turn.
+	ErrJokerNotReused = errors.New("game: retrieved joker not played")
+	// ErrNotInHand is returned when a tile added to the board is not in the
+	// hand of the player.
+	ErrNotInHand = errors.New("game: tile not in hand")
+	// ErrNoTilePlayed is returned when a turn adds no tiles to the board.
+	ErrNoTilePlayed = errors.New("game: no tile played")
+)
+
+// ValidateTurn checks that a player, holding hand, may change the board from
+// before to after in a turn. Players may rearrange the sets on the board
+// freely, as long as every tile on the board before is on the board after, and
+// every set after is valid. In particular, a joker retrieved from a set must be
+// played again. ValidateTurn returns the tiles from hand that the player added
+// to the board, at least one, in the order they appear on the board after.
+func ValidateTurn(before, after Board, hand []Tile) (played []Tile, err error) {
+	if !after.Valid() {
+		return nil, ErrInvalidBoard
+	}
+	added := make(map[Tile]int)
+	for _, set := range after {
+		for _, t := range set {
+			added[t.face()]++
+		}
+	}
+	for _, set := range before {
+		for _, t := range set {
+			added[t.face()]--
+		}
+	}
+	for t, n := range added {
+		if n >= 0 {
+			continue
+		}
+		if t.IsJoker() {
+			return nil, ErrJokerNotReused
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTileRemoved, t)
+	}
+	held := make(map[Tile]int)
+	for _, t := range hand {
+		held[t.face()]++
+	}
+	for _, set := range after {
+		for _, t := range set {
+			t = t.face()
+			if added[t] == 0 {
+				continue
+			}
+			if held[t] == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrNotInHand, t)
+			}
+			added[t]--
+			held[t]--
+			played = append(played, t)
+		}
+	}
+	if len(played) == 0 {
+		return nil, ErrNoTilePlayed
+	}
+	return played, nil
+}
+
+// face returns t, or Joker if t is any joker, such that tiles with the same
+// face compare equal.
+func (t Tile) face() Tile {
+	if t.IsJoker() {
+		return Joker
+	}
+	return t
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTurn(t *testing.T) {
+	run := []Tile{{2, Red}, {3, Red}, {4, Red}}
+	group := []Tile{{7, Red}, {7, Green}, {7, Blue}}
+	withJoker := []Tile{{5, Blue}, Joker, {7, Blue}}
+	tests := []struct {
+		name   string
+		before Board
+		after  Board
+		hand   []Tile
+		played []Tile
+		err    error
+	}{
+		{
+			name:   "new set",
+			before: Board{},
+			after:  Board{}.Add(run...),
+			hand:   []Tile{{4, Red}, {2, Red}, {3, Red}, {9, Blue}},
+			played: run,
+		},
+		{
+			name:   "extend set",
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(append(append([]Tile(nil), run...), Tile{5, Red})...),
+			hand:   []Tile{{5, Red}},
+			played: []Tile{{5, Red}},
+		},
+		{
+			name:   "rearrange sets",
+			before: Board{}.Add(Tile{3, Red}, Tile{4, Red}, Tile{5, Red}, Tile{6, Red}).Add(group...),
+			after: Board{}.
+				Add(Tile{3, Red}, Tile{4, Red}, Tile{5, Red}).
+				Add(Tile{6, Red}, Tile{7, Red}, Tile{8, Red}).
+				Add(Tile{7, Green}, Tile{7, Blue}, Tile{7, Yellow}),
+			hand:   []Tile{{8, Red}, {7, Yellow}},
+			played: []Tile{{8, Red}, {7, Yellow}},
+		},
+		{
+			name:   "retrieve and reuse joker",
+			before: Board{}.Add(withJoker...),
+			after: Board{}.
+				Add(Tile{5, Blue}, Tile{6, Blue}, Tile{7, Blue}).
+				Add(Tile{9, Red}, Joker, Tile{11, Red}),
+			hand:   []Tile{{6, Blue}, {9, Red}, {11, Red}},
+			played: []Tile{{6, Blue}, {9, Red}, {11, Red}},
+		},
+		{
+			name:   "retrieve joker without reusing it",
+			before: Board{}.Add(withJoker...),
+			after:  Board{}.Add(Tile{5, Blue}, Tile{6, Blue}, Tile{7, Blue}),
+			hand:   []Tile{{6, Blue}},
+			err:    ErrJokerNotReused,
+		},
+		{
+			name:   "play joker from hand",
+			before: Board{},
+			after:  Board{}.Add(Tile{1, Yellow}, Tile{2, Yellow}, Joker),
+			hand:   []Tile{{2, Yellow}, {1, Yellow}, {Color: Green}},
+			played: []Tile{{1, Yellow}, {2, Yellow}, Joker},
+		},
+		{
+			name:   "invalid board",
+			before: Board{},
+			after:  Board{}.Add(Tile{2, Red}, Tile{3, Red}),
+			hand:   []Tile{{2, Red}, {3, Red}},
+			err:    ErrInvalidBoard,
+		},
+		{
+			name:   "remove tile from board",
+			before: Board{}.Add(append(append([]Tile(nil), run...), Tile{5, Red})...),
+			after:  Board{}.Add(run...),
+			hand:   []Tile{{1, Red}},
+			err:    ErrTileRemoved,
+		},
+		{
+			name:   "swap tile from board into hand",
+			before: Board{}.Add(Tile{1, Red}, Tile{2, Red}, Tile{3, Red}, Tile{4, Red}),
+			after:  Board{}.Add(Tile{2, Red}, Tile{3, Red}, Tile{4, Red}, Tile{5, Red}),
+			hand:   []Tile{{5, Red}},
+			err:    ErrTileRemoved,
+		},
+		{
+			name:   "tile not in hand",
+			before: Board{},
+			after:  Board{}.Add(run...),
+			hand:   []Tile{{2, Red}, {3, Red}},
+			err:    ErrNotInHand,
+		},
+		{
+			name:   "second copy not in hand",
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(run...).Add(run...),
+			hand:   []Tile{{2, Red}, {3, Red}, {4, Green}},
+			err:    ErrNotInHand,
+		},
+		{
+			name:   "descending run",
+			before: Board{}.Add(Tile{2, Red}, Tile{3, Red}, Tile{4, Red}, Tile{5, Red}),
+			after:  Board{}.Add(Tile{5, Red}, Tile{4, Red}, Tile{3, Red}, Tile{2, Red}),
+			hand:   []Tile{{1, Red}},
+			err:    ErrInvalidBoard,
+		},
+		{
+			name:   "nothing changed",
+			before: Board{}.Add(run...),
+			after:  Board{}.Add(run...),
+			hand:   []Tile{{1, Red}},
+			err:    ErrNoTilePlayed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			played, err := ValidateTurn(tt.before, tt.after, tt.hand)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(played, tt.played) {
+				t.Errorf("played %v, want %v", played, tt.played)
+			}
+		})
+	}
+}
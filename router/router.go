@@ -2,40 +2,115 @@ package router
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rhcarvalho/tiwe/crypto/identity"
+)
+
+// Errors returned by Conn.Recv for messages that are rejected.
+var (
+	// ErrForged is returned for messages whose signature does not match
+	// their sender.
+	ErrForged = errors.New("router: forged message")
+	// ErrReplayed is returned for messages received out of sequence.
+	ErrReplayed = errors.New("router: replayed message")
 )
 
 // A Router broadcasts messages to all registered parties.
 type Router interface {
-	Register(ctx context.Context) (Conn, error)
+	// Register registers a new party with the given identity. Messages
+	// sent through the returned Conn are signed with it.
+	Register(ctx context.Context, id ed25519.PrivateKey) (Conn, error)
 }
 
 // A Conn allows sending messages to and receiving messages from a Router.
 type Conn interface {
+	// Send signs m as sent by the identity of the Conn, setting its From,
+	// ID and Signature, and sends it.
 	Send(ctx context.Context, m Message) error
+	// Recv returns the next message. It returns an error wrapping
+	// ErrForged or ErrReplayed for messages whose signature does not
+	// verify or that are out of sequence, and more messages can be
+	// received after that.
 	Recv(ctx context.Context) (Message, error)
 }
 
 // A Message is a container to transfer data among parties.
 type Message struct {
+	// From is the identity of the sender, encoded with identity.Encode.
 	From string
+	// GameID identifies the game the message belongs to.
+	GameID string
+	// ID is the sequence number of the message among those sent by From
+	// in the game, starting at zero.
 	ID   int
 	Data []byte
+	// Signature is the signature of GameID, ID and Data by From, see
+	// identity.Sign.
+	Signature []byte
 }
 
 // gobConn implements Conn by marshaling messages using the encoding/gob format.
 type gobConn struct {
-	enc *gob.Encoder
-	dec *gob.Decoder
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+	key  ed25519.PrivateKey
+	from string
+
+	mu   sync.Mutex
+	sent map[string]int // number of messages sent, per game
+	next map[string]int // next expected ID, per sender and game
+}
+
+func newGobConn(r io.Reader, w io.Writer, key ed25519.PrivateKey) *gobConn {
+	return &gobConn{
+		enc:  gob.NewEncoder(w),
+		dec:  gob.NewDecoder(r),
+		key:  key,
+		from: identity.Encode(key.Public().(ed25519.PublicKey)),
+		sent: make(map[string]int),
+		next: make(map[string]int),
+	}
 }
 
 // Send implements Conn.
 func (c *gobConn) Send(ctx context.Context, m Message) error {
-	return c.enc.Encode(m)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.From = c.from
+	m.ID = c.sent[m.GameID]
+	m.Signature = identity.Sign(c.key, m.GameID, uint64(m.ID), m.Data)
+	if err := c.enc.Encode(m); err != nil {
+		return err
+	}
+	c.sent[m.GameID]++
+	return nil
 }
 
 // Recv implements Conn.
 func (c *gobConn) Recv(ctx context.Context) (Message, error) {
 	var m Message
-	return m, c.dec.Decode(&m)
+	if err := c.dec.Decode(&m); err != nil {
+		return m, err
+	}
+	pub, err := identity.Decode(m.From)
+	if err != nil {
+		return m, fmt.Errorf("%w: %v", ErrForged, err)
+	}
+	if m.ID < 0 || identity.Verify(pub, m.GameID, uint64(m.ID), m.Data, m.Signature) != nil {
+		return m, fmt.Errorf("%w from %s", ErrForged, m.From)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := m.From + "\x00" + m.GameID
+	if m.ID != c.next[k] {
+		return m, fmt.Errorf("%w from %s: got ID %d, want %d", ErrReplayed, m.From, m.ID, c.next[k])
+	}
+	c.next[k]++
+	return m, nil
 }
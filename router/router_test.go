@@ -0,0 +1,99 @@
+package router
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/identity"
+)
+
+func newIdentity(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	key, err := identity.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTestRouter(t *testing.T) {
+	ctx := context.Background()
+	r := NewTestRouter(0, 0)
+	alice, bob := newIdentity(t), newIdentity(t)
+	a, err := r.Register(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Register(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		// The forged From and ID are replaced.
+		if err := a.Send(ctx, Message{From: "bob", ID: 42, GameID: "game", Data: []byte{byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []Conn{a, b} {
+			m, err := c.Recv(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := identity.Encode(alice.Public().(ed25519.PublicKey)); m.From != want || m.ID != i {
+				t.Errorf("got message from %s with ID %d, want from %s with ID %d", m.From, m.ID, want, i)
+			}
+		}
+	}
+}
+
+func TestRecvRejects(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newIdentity(t), newIdentity(t)
+	r, w := io.Pipe()
+	c := newGobConn(r, ioutil.Discard, bob)
+	enc := gob.NewEncoder(w)
+
+	sign := func(m Message) Message {
+		m.From = identity.Encode(alice.Public().(ed25519.PublicKey))
+		m.Signature = identity.Sign(alice, m.GameID, uint64(m.ID), m.Data)
+		return m
+	}
+	valid := sign(Message{GameID: "game", ID: 0, Data: []byte("hi")})
+	forged := valid
+	forged.From = identity.Encode(bob.Public().(ed25519.PublicKey))
+	tampered := valid
+	tampered.Data = []byte("bye")
+	otherGame := valid
+	otherGame.GameID = "other"
+
+	tests := []struct {
+		name string
+		m    Message
+		want error
+	}{
+		{"forged sender", forged, ErrForged},
+		{"tampered data", tampered, ErrForged},
+		{"other game", otherGame, ErrForged},
+		{"invalid sender", Message{From: "x"}, ErrForged},
+		{"valid", valid, nil},
+		{"replayed", valid, ErrReplayed},
+		{"skipped", sign(Message{GameID: "game", ID: 2}), ErrReplayed},
+	}
+	go func() {
+		for _, tt := range tests {
+			if err := enc.Encode(tt.m); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for _, tt := range tests {
+		_, err := c.Recv(ctx)
+		if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package router
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/gob"
 	"io"
+	mathrand "math/rand"
 	"sync"
 	"time"
 
@@ -19,6 +21,10 @@ type TestRouter struct {
 		Mean   time.Duration
 		StdDev time.Duration
 	}
+	// Rand is the source of the simulated latencies. If nil, rand.Rand is
+	// used. Set it to a value from rand.NewDeterministic to replay the
+	// same latencies.
+	Rand *mathrand.Rand
 
 	mu   sync.RWMutex
 	encs []*gob.Encoder
@@ -33,15 +39,13 @@ func NewTestRouter(mean, sd time.Duration) *TestRouter {
 	return &r
 }
 
-// Register registers a new party. It returns a Conn that can be used to
-// broadcast and receive messages.
-func (r *TestRouter) Register(ctx context.Context) (Conn, error) {
+// Register registers a new party with the given identity. It returns a Conn
+// that can be used to broadcast and receive messages.
+func (r *TestRouter) Register(ctx context.Context, id ed25519.PrivateKey) (Conn, error) {
 	in1, out1 := io.Pipe()
 	in2, out2 := io.Pipe()
-	enc1 := gob.NewEncoder(out1)
 	dec1 := gob.NewDecoder(in1)
 	enc2 := gob.NewEncoder(out2)
-	dec2 := gob.NewDecoder(in2)
 	r.mu.Lock()
 	r.encs = append(r.encs, enc2)
 	r.mu.Unlock()
@@ -63,15 +67,16 @@ func (r *TestRouter) Register(ctx context.Context) (Conn, error) {
 			r.mu.RUnlock()
 		}
 	}()
-	return &gobConn{
-		enc: enc1,
-		dec: dec2,
-	}, nil
+	return newGobConn(in2, out1, id), nil
 }
 
 // simulateNetworkLatency simulates network latency by sleeping for a random
 // duration with normal distribution.
 func (r *TestRouter) simulateNetworkLatency() {
-	d := time.Duration(rand.NormFloat64()*float64(r.Latency.StdDev) + float64(r.Latency.Mean))
+	rng := r.Rand
+	if rng == nil {
+		rng = rand.Rand
+	}
+	d := time.Duration(rng.NormFloat64()*float64(r.Latency.StdDev) + float64(r.Latency.Mean))
 	time.Sleep(d)
 }
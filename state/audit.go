@@ -0,0 +1,211 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+)
+
+// An AuditReport is the result of re-running the transcript of a game with the
+// keys revealed at its end.
+type AuditReport struct {
+	// Cheaters maps each player whose revealed keys do not reproduce their
+	// published messages to the first discrepancy found.
+	Cheaters map[int]error
+	// Unaudited are the players who left the game, and thus revealed no
+	// keys.
+	Unaudited []int
+}
+
+// Players returns the players named in the report as cheaters, in increasing
+// order.
+func (r *AuditReport) Players() []int {
+	var players []int
+	for p := range r.Cheaters {
+		players = append(players, p)
+	}
+	sort.Ints(players)
+	return players
+}
+
+// Audit runs the audit sub-protocol at the end of a game. Every remaining
+// player, in gameplay order, reveals their master secret, opening the
+// commitment made before the shuffle. Every player then independently derives
+// the keys of all players and re-runs every encryption and decryption in the
+// transcript of the game, naming in the report any player whose keys do not
+// reproduce the tiles they published.
+//
+// Audit must be called by all remaining players after Run, and after
+// RecoverPool if a player left. Revealing the master secret reveals all tiles,
+// so Audit must only be called when the game is over.
+func (m *Machine) Audit(ctx context.Context) (*AuditReport, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.hand == nil {
+		return nil, errors.New("cannot audit: game not dealt")
+	}
+	m.ctx = ctx
+	m.turn = 0
+	m.report = &AuditReport{Cheaters: make(map[int]error)}
+	m.masters = make([][]byte, m.nPlayers)
+	for state := stateRevealKeys; state != nil; {
+		state = state(m)
+	}
+	if err := m.Err(); err != nil {
+		return nil, err
+	}
+	return m.report, nil
+}
+
+// stateRevealKeys lets each remaining player, in gameplay order, reveal their
+// master secret.
+func stateRevealKeys(m *Machine) Fn {
+	if m.turn == len(m.order) {
+		m.turn = 0
+		return stateAuditTranscript
+	}
+	player := m.order[m.turn]
+	m.turn++
+	if m.departed[player] {
+		m.report.Unaudited = append(m.report.Unaudited, player)
+		return stateRevealKeys
+	}
+
+	if m.whoAmI == player {
+		m.logf("Out <- master secret")
+		if err := m.send(m.keysOpening); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var o commit.Opening
+	if err := m.recv(player, &o); err != nil {
+		var perr *ProtocolError
+		if !errors.As(err, &perr) {
+			return m.Fail(err)
+		}
+		m.report.Cheaters[player] = err
+		return stateRevealKeys
+	}
+	m.logf("In -> master secret of player #%d", player)
+	if err := commit.Verify(m.keysDomain(player), m.keyCommitments[player-1], o); err != nil {
+		m.report.Cheaters[player] = fmt.Errorf("master secret: %w", err)
+		return stateRevealKeys
+	}
+	m.masters[player-1] = o.Value
+	return stateRevealKeys
+}
+
+// stateAuditTranscript re-runs the transcript with the revealed keys.
+func stateAuditTranscript(m *Machine) Fn {
+	for turn, player := range m.order {
+		if m.masters[player-1] == nil {
+			continue
+		}
+		if err := m.auditTurn(turn, m.masters[player-1]); err != nil {
+			m.report.Cheaters[player] = err
+		}
+	}
+	m.logf("audit: cheaters %v", m.report.Players())
+	return nil
+}
+
+// auditTurn checks that the keys derived from master reproduce the messages
+// published by the player at the given turn in gameplay order.
+func (m *Machine) auditTurn(turn int, master []byte) error {
+	player := m.order[turn]
+	derive := func(label string, index int) provingKey {
+		return deriveKey(m.Params, master, m.GameID, label, index)
+	}
+
+	// The shuffled pool is the previous pool encrypted with the initial
+	// key, in any order.
+	initial := derive("initial", 0)
+	in := m.codec.Deck()
+	if turn > 0 {
+		in = m.shuffled[turn-1]
+	}
+	want := make(map[string]bool, len(in))
+	for _, c := range in {
+		e, err := initial.Encrypt(c)
+		if err != nil {
+			return fmt.Errorf("shuffle: %w", err)
+		}
+		want[string(e)] = true
+	}
+	for i, c := range m.shuffled[turn] {
+		if !want[string(c)] {
+			return fmt.Errorf("shuffle: tile %d not encrypted with initial key", i)
+		}
+	}
+
+	// The rekeyed pool is the previous pool decrypted with the initial key
+	// and encrypted with the tile keys, which match their commitments.
+	y, err := initial.Commitment()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(y, m.initialKeys[player-1]) {
+		return fmt.Errorf("rekey: commitment to initial key does not match")
+	}
+	in = m.shuffled[len(m.shuffled)-1]
+	if turn > 0 {
+		in = m.rekeyed[turn-1]
+	}
+	tileKeys := make([]provingKey, len(in))
+	for i, c := range in {
+		tileKeys[i] = derive("tile", i)
+		p, err := initial.Decrypt(c)
+		if err != nil {
+			return fmt.Errorf("rekey: tile %d: %w", i, err)
+		}
+		e, err := tileKeys[i].Encrypt(p)
+		if err != nil {
+			return fmt.Errorf("rekey: tile %d: %w", i, err)
+		}
+		if !bytes.Equal(e, m.rekeyed[turn][i]) {
+			return fmt.Errorf("rekey: tile %d not encrypted with tile key", i)
+		}
+		y, err := tileKeys[i].Commitment()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(y, m.commitments[player-1][i]) {
+			return fmt.Errorf("rekey: commitment to key of tile %d does not match", i)
+		}
+	}
+	if m.escrowEnabled() {
+		y, err := derive("escrow", 0).Commitment()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(y, m.escrowKeys[player-1]) {
+			return fmt.Errorf("rekey: commitment to escrow key does not match")
+		}
+	}
+
+	// Revealed values are the decryptions of dealt tiles, as revealed by
+	// the players before.
+	partial := make([][]byte, len(m.order)*handSize)
+	copy(partial, m.rekeyed[len(m.rekeyed)-1])
+	for t := 0; t < turn; t++ {
+		for j, i := range m.revealedBy(m.order[t]) {
+			partial[i] = m.revealed[t][j]
+		}
+	}
+	for j, i := range m.revealedBy(player) {
+		v, err := tileKeys[i].Decrypt(partial[i])
+		if err != nil {
+			return fmt.Errorf("deal: tile %d: %w", i, err)
+		}
+		if !bytes.Equal(v, m.revealed[turn][j]) {
+			return fmt.Errorf("deal: tile %d not decrypted with tile key", i)
+		}
+	}
+	return nil
+}
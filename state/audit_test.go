@@ -0,0 +1,188 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"crypto/ed25519"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+)
+
+// audit runs Audit for all machines, returning the reports.
+func audit(t *testing.T, ms []*Machine, tamper func(*Message)) []*AuditReport {
+	t.Helper()
+	reports := make([]*AuditReport, len(ms))
+	errs := broadcast(ms, tamper, func(m *Machine) error {
+		r, err := m.Audit(context.Background())
+		for i := range ms {
+			if ms[i] == m {
+				reports[i] = r
+			}
+		}
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", ms[i].whoAmI, err)
+		}
+	}
+	return reports
+}
+
+func TestStateMachineAudit(t *testing.T) {
+	const nPlayers = 3
+	ms, errs := runGame(t, sra.P256, nPlayers, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	for i, r := range audit(t, ms, nil) {
+		if len(r.Cheaters) != 0 || len(r.Unaudited) != 0 {
+			t.Errorf("player #%d: got report %+v, want no cheaters", i+1, r)
+		}
+	}
+}
+
+func TestStateMachineAuditCheater(t *testing.T) {
+	const nPlayers = 3
+	// ms are the machines of the running test case.
+	var ms []*Machine
+	tests := []struct {
+		name string
+		// n is the index of the tampered message, counting from 1, in
+		// the game or, if inAudit, in the audit.
+		n       int
+		inAudit bool
+		tamper  func(t *testing.T, msg *Message)
+		want    string
+	}{
+		{
+			// Rekeying a tile that is never dealt with a key not
+			// derived from the master secret goes unnoticed during
+			// the game.
+			name: "rekey",
+			n:    5*nPlayers + 1,
+			tamper: func(t *testing.T, msg *Message) {
+				var pm poolMessage
+				decodeMessage(t, msg, &pm)
+				// The sender does not change its fields until
+				// it receives its own message.
+				m := ms[ms[0].Player(msg.From)-1]
+				last := len(pm.Pool) - 1
+				key := sra.DeriveKeyWithParams(m.Params, []byte("not the master secret"), m.GameID, "tile", last)
+				p, err := m.key.Decrypt(m.pool[last])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if pm.Pool[last], err = key.Encrypt(p); err != nil {
+					t.Error(err)
+					return
+				}
+				if pm.Commitments[last], err = key.Commitment(); err != nil {
+					t.Error(err)
+					return
+				}
+				if pm.Proofs[last], err = m.key.ProveRekey(nil, key, m.pool[last], pm.Pool[last]); err != nil {
+					t.Error(err)
+					return
+				}
+				encodeMessage(t, msg, pm)
+			},
+			want: "rekey: tile 105 not encrypted with tile key",
+		},
+		{
+			name:    "master secret",
+			n:       1,
+			inAudit: true,
+			tamper: func(t *testing.T, msg *Message) {
+				var o commit.Opening
+				decodeMessage(t, msg, &o)
+				o.Value[0] ^= 1
+				encodeMessage(t, msg, o)
+			},
+			want: commit.ErrInvalidOpening.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int
+			var culpritKey ed25519.PublicKey
+			tamper := func(msg *Message) {
+				n++
+				if n != tt.n {
+					return
+				}
+				culpritKey = msg.From
+				tt.tamper(t, msg)
+			}
+			var gameTamper, auditTamper func(*Message)
+			if tt.inAudit {
+				auditTamper = tamper
+			} else {
+				gameTamper = tamper
+			}
+			ms = nil
+			collect := func(m *Machine) { ms = append(ms, m) }
+			_, errs := runGame(t, sra.P256, nPlayers, gameTamper, collect)
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("player #%d: %v", i+1, err)
+				}
+			}
+			reports := audit(t, ms, auditTamper)
+			culprit := ms[0].Player(culpritKey)
+			for i, r := range reports {
+				if got, want := r.Players(), []int{culprit}; !reflect.DeepEqual(got, want) {
+					t.Errorf("player #%d: named %v, want %v", i+1, got, want)
+					continue
+				}
+				if err := r.Cheaters[culprit]; !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStateMachineAuditAfterRecovery(t *testing.T) {
+	const nPlayers = 3
+	ms, errs := runGame(t, sra.P256, nPlayers, nil, withEscrow(2))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	departed := ms[0].order[1]
+	remaining, errs := recoverPool(t, ms, departed, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", remaining[i].whoAmI, err)
+		}
+	}
+	for i, r := range audit(t, remaining, nil) {
+		if len(r.Cheaters) != 0 {
+			t.Errorf("player #%d: named %v, want no cheaters: %v", remaining[i].whoAmI, r.Players(), r.Cheaters)
+		}
+		if want := []int{departed}; !reflect.DeepEqual(r.Unaudited, want) {
+			t.Errorf("player #%d: unaudited %v, want %v", remaining[i].whoAmI, r.Unaudited, want)
+		}
+	}
+}
+
+func TestAuditBeforeDeal(t *testing.T) {
+	m := &Machine{nPlayers: 2, whoAmI: 1}
+	if _, err := m.Audit(context.Background()); err == nil {
+		t.Error("got nil error, want error")
+	}
+	m.err = errors.New("failed")
+	if _, err := m.Audit(context.Background()); err != m.err {
+		t.Errorf("got error %v, want %v", err, m.err)
+	}
+}
@@ -0,0 +1,133 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+// handSize is the number of tiles dealt to each player.
+const handSize = game.HandSize
+
+// A revealMessage is the payload of messages in the deal phase. The sender
+// removes their encryption layer from tiles dealt to other players, proving
+// that each decryption used the key they committed to.
+type revealMessage struct {
+	Values [][]byte
+	Proofs [][]byte
+}
+
+// startDeal prepares the deal phase. Tiles are dealt from the top of the pool,
+// handSize tiles to each player in gameplay order.
+func (m *Machine) startDeal() Fn {
+	m.partial = make([][]byte, m.drawn)
+	copy(m.partial, m.pool)
+	return stateDealTiles
+}
+
+// owner returns the player to whom the tile at position i of the pool is dealt,
+// or who drew it.
+func (m *Machine) owner(i int) int {
+	if k := i - len(m.order)*handSize; k >= 0 {
+		return m.drawers[k]
+	}
+	return m.order[i/handSize]
+}
+
+// revealedBy returns the positions of dealt tiles that player must reveal, that
+// is, the tiles dealt to other players.
+func (m *Machine) revealedBy(player int) []int {
+	var positions []int
+	for i := 0; i < len(m.order)*handSize; i++ {
+		if m.owner(i) != player {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// stateDealTiles lets each player, in gameplay order, reveal their decryption of
+// tiles dealt to other players. After all players have revealed, every player
+// decrypts their own tiles.
+func stateDealTiles(m *Machine) Fn {
+	player := m.order[m.turn]
+	positions := m.revealedBy(player)
+
+	if m.whoAmI == player {
+		var msg revealMessage
+		for _, i := range positions {
+			key := m.tileKeys[i]
+			value, err := key.Decrypt(m.partial[i])
+			if err != nil {
+				return m.Fail(err)
+			}
+			proof, err := key.ProveDecryption(m.Rand, m.partial[i], value)
+			if err != nil {
+				return m.Fail(err)
+			}
+			msg.Values = append(msg.Values, value)
+			msg.Proofs = append(msg.Proofs, proof)
+		}
+		m.logf("Out <- %d revealed tiles", len(msg.Values))
+		if err := m.send(msg); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var msg revealMessage
+	if err := m.recv(player, &msg); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> %d revealed tiles", len(msg.Values))
+	if len(msg.Values) != len(positions) || len(msg.Proofs) != len(positions) {
+		return m.Violation(player, fmt.Errorf("revealed %d tiles with %d proofs, want %d", len(msg.Values), len(msg.Proofs), len(positions)))
+	}
+	for j, i := range positions {
+		if err := m.verifyReveal(player, i, msg.Values[j], msg.Proofs[j]); err != nil {
+			return m.Violation(player, fmt.Errorf("tile %d: %w", i, err))
+		}
+		m.partial[i] = msg.Values[j]
+	}
+	m.revealed = append(m.revealed, msg.Values)
+
+	m.turn++
+	if m.turn < len(m.order) {
+		return stateDealTiles
+	}
+	m.turn = 0
+	for i := range m.partial {
+		if m.owner(i) != m.whoAmI {
+			continue
+		}
+		tile, err := m.openTile(i)
+		if err != nil {
+			return m.Fail(err)
+		}
+		m.hand = append(m.hand, tile)
+		m.handPositions = append(m.handPositions, i)
+	}
+	m.logf("hand: %v", m.hand)
+	return nil
+}
+
+// verifyReveal verifies that value is the decryption of the tile at position i
+// with the key player committed to.
+func (m *Machine) verifyReveal(player, i int, value, proof []byte) error {
+	return sra.VerifyDecryption(m.Params, m.commitments[player-1][i], m.partial[i], value, proof)
+}
+
+// openTile removes the last encryption layer of the tile at position i, after
+// all other players revealed their decryption.
+func (m *Machine) openTile(i int) (game.Tile, error) {
+	key := m.tileKeys[i]
+	ct := game.Sealed(m.codec, m.partial[i], key.Fingerprint())
+	if err := ct.Open(key); err != nil {
+		return game.Tile{}, fmt.Errorf("cannot open tile %d: %w", i, err)
+	}
+	tile, err := ct.Tile()
+	if err != nil {
+		return game.Tile{}, fmt.Errorf("cannot open tile %d: %w", i, err)
+	}
+	return *tile, nil
+}
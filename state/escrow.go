@@ -0,0 +1,274 @@
+package state
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// An escrowMessage is the payload of messages in the escrow phase. The sender
+// shares the decryption exponent of each of their keys of tiles left in the
+// pool after the deal among the other players, see sra.Key.ShareDecryption.
+type escrowMessage struct {
+	// Sharings are public, one per tile left in the pool.
+	Sharings []sra.Sharing
+	// Boxes hold the shares of each player, one per tile left in the pool,
+	// encrypted to that player. The box of the sender is empty.
+	Boxes [][]byte
+}
+
+// A recoverMessage is the payload of messages in the recovery sub-protocol. The
+// sender partially decrypts every tile in the pool with their shares of the
+// keys of a departed player.
+type recoverMessage struct {
+	Values [][]byte
+	Proofs [][]byte
+}
+
+// escrowEnabled reports whether tile keys are escrowed.
+func (m *Machine) escrowEnabled() bool {
+	return m.EscrowThreshold > 0
+}
+
+// stateEscrowKeys lets each player, in gameplay order, share their keys of the
+// tiles left in the pool after the deal among the other players, such that
+// EscrowThreshold of them can remove the layer of encryption of a player that
+// leaves the game from the tiles in the pool, see RecoverPool. Keys of dealt
+// tiles are not shared: every other player removes their layer from the tiles
+// dealt to a player, and the shares would reveal the hand.
+func stateEscrowKeys(m *Machine) Fn {
+	player := m.order[m.turn]
+	positions := m.undrawn()
+
+	if m.whoAmI == player {
+		msg := escrowMessage{
+			Sharings: make([]sra.Sharing, len(positions)),
+			Boxes:    make([][]byte, m.nPlayers),
+		}
+		var holders []int
+		for p := 1; p <= m.nPlayers; p++ {
+			if p != m.whoAmI {
+				holders = append(holders, p)
+			}
+		}
+		shares := make([][]byte, m.nPlayers)
+		for j, i := range positions {
+			s, ss, err := m.tileKeys[i].ShareDecryption(m.Rand, m.EscrowThreshold, holders)
+			if err != nil {
+				return m.Fail(err)
+			}
+			msg.Sharings[j] = *s
+			for k, p := range holders {
+				shares[p-1] = append(shares[p-1], ss[k]...)
+			}
+		}
+		for _, p := range holders {
+			aead, err := m.escrowBox(m.whoAmI, p)
+			if err != nil {
+				return m.Fail(err)
+			}
+			msg.Boxes[p-1] = aead.Seal(nil, make([]byte, aead.NonceSize()), shares[p-1], nil)
+		}
+		m.logf("Out <- escrow of %d tile keys", len(msg.Sharings))
+		if err := m.send(msg); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var msg escrowMessage
+	if err := m.recv(player, &msg); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> escrow of %d tile keys", len(msg.Sharings))
+	if len(msg.Sharings) != len(positions) || len(msg.Boxes) != m.nPlayers {
+		return m.Violation(player, fmt.Errorf("escrow: got %d sharings and %d boxes, want %d and %d", len(msg.Sharings), len(msg.Boxes), len(positions), m.nPlayers))
+	}
+	// Sharings are kept by position in the pool.
+	m.sharings[player-1] = make([]sra.Sharing, len(m.pool))
+	for j, i := range positions {
+		if err := sra.VerifySharing(m.Params, m.commitments[player-1][i], &msg.Sharings[j], m.EscrowThreshold); err != nil {
+			return m.Violation(player, fmt.Errorf("escrow: tile %d: %w", i, err))
+		}
+		m.sharings[player-1][i] = msg.Sharings[j]
+	}
+	if player != m.whoAmI {
+		shares, err := m.openEscrowBox(player, positions, msg)
+		if err != nil {
+			return m.Violation(player, fmt.Errorf("escrow: %w", err))
+		}
+		m.shares[player-1] = shares
+	}
+
+	m.turn++
+	if m.turn == len(m.order) {
+		m.turn = 0
+		return m.startDeal()
+	}
+	return stateEscrowKeys
+}
+
+// openEscrowBox decrypts and verifies the shares sent by player of the keys of
+// the tiles at the given positions in the pool. It returns the shares by
+// position in the pool.
+func (m *Machine) openEscrowBox(player int, positions []int, msg escrowMessage) ([][]byte, error) {
+	aead, err := m.escrowBox(player, m.whoAmI)
+	if err != nil {
+		return nil, err
+	}
+	b, err := aead.Open(nil, make([]byte, aead.NonceSize()), msg.Boxes[m.whoAmI-1], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open shares: %w", err)
+	}
+	size := len(b) / len(msg.Sharings)
+	if size*len(msg.Sharings) != len(b) {
+		return nil, fmt.Errorf("got %d bytes of shares for %d tiles", len(b), len(msg.Sharings))
+	}
+	shares := make([][]byte, len(m.pool))
+	for j, i := range positions {
+		shares[i] = b[j*size : (j+1)*size]
+		if err := sra.VerifyShare(m.Params, &msg.Sharings[j], m.whoAmI, shares[i]); err != nil {
+			return nil, fmt.Errorf("tile %d: %w", i, err)
+		}
+	}
+	return shares, nil
+}
+
+// escrowBox returns the AEAD that encrypts shares from dealer to holder, keyed
+// with the Diffie–Hellman secret of their escrow keys.
+func (m *Machine) escrowBox(dealer, holder int) (cipher.AEAD, error) {
+	peer := holder
+	if holder == m.whoAmI {
+		peer = dealer
+	}
+	dh, err := m.escrowKey.Encrypt(m.escrowKeys[peer-1])
+	if err != nil {
+		return nil, err
+	}
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/state escrow\x00"))
+	for _, b := range [][]byte{[]byte(m.GameID), dh} {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+		h.Write(l[:])
+		h.Write(b)
+	}
+	var ids [8]byte
+	binary.BigEndian.PutUint32(ids[:4], uint32(dealer))
+	binary.BigEndian.PutUint32(ids[4:], uint32(holder))
+	h.Write(ids[:])
+	return chacha20poly1305.New(h.Sum(nil))
+}
+
+// RecoverPool runs the recovery sub-protocol after player left the game, such
+// that the game can continue without them. The first EscrowThreshold remaining
+// players in gameplay order partially decrypt every tile in the pool with
+// their shares of the tile keys of player, proving that they used the shares
+// committed to in the escrow phase. Every remaining player then removes the
+// layer of encryption of player from the tiles in the pool. Tiles dealt to
+// player stay concealed.
+//
+// RecoverPool must be called by all remaining players after Run, with In and
+// Out connected to the remaining players only. It requires EscrowThreshold to be
+// set.
+func (m *Machine) RecoverPool(ctx context.Context, player int) error {
+	if m.err != nil {
+		return m.err
+	}
+	if !m.escrowEnabled() || m.hand == nil {
+		return fmt.Errorf("cannot recover pool: keys were not escrowed")
+	}
+	if player < 1 || player > m.nPlayers || player == m.whoAmI || m.departed[player] {
+		return fmt.Errorf("cannot recover pool: invalid player %d", player)
+	}
+	m.departed[player] = true
+	m.recovering = player
+	m.quorum = m.quorum[:0]
+	for _, p := range m.order {
+		if !m.departed[p] && len(m.quorum) < m.EscrowThreshold {
+			m.quorum = append(m.quorum, p)
+		}
+	}
+	if len(m.quorum) < m.EscrowThreshold {
+		return fmt.Errorf("cannot recover pool: %d players left, want %d or more", len(m.quorum), m.EscrowThreshold)
+	}
+	m.ctx = ctx
+	m.turn = 0
+	m.recovered = make([][][]byte, len(m.pool))
+	for state := stateRecoverPool; state != nil; {
+		state = state(m)
+	}
+	return m.Err()
+}
+
+// stateRecoverPool lets each player in the quorum reveal their partial
+// decryptions of the tiles in the pool.
+func stateRecoverPool(m *Machine) Fn {
+	player := m.quorum[m.turn]
+	departed := m.recovering
+	positions := m.undrawn()
+
+	if m.whoAmI == player {
+		var msg recoverMessage
+		for _, i := range positions {
+			value, proof, err := sra.PartialDecrypt(m.Params, m.Rand, m.shares[departed-1][i], m.pool[i])
+			if err != nil {
+				return m.Fail(err)
+			}
+			msg.Values = append(msg.Values, value)
+			msg.Proofs = append(msg.Proofs, proof)
+		}
+		m.logf("Out <- %d partially decrypted tiles", len(msg.Values))
+		if err := m.send(msg); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var msg recoverMessage
+	if err := m.recv(player, &msg); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> %d partially decrypted tiles", len(msg.Values))
+	if len(msg.Values) != len(positions) || len(msg.Proofs) != len(positions) {
+		return m.Violation(player, fmt.Errorf("recovery: got %d values with %d proofs, want %d", len(msg.Values), len(msg.Proofs), len(positions)))
+	}
+	for j, i := range positions {
+		s := &m.sharings[departed-1][i]
+		if err := sra.VerifyPartialDecryption(m.Params, s, player, m.pool[i], msg.Values[j], msg.Proofs[j]); err != nil {
+			return m.Violation(player, fmt.Errorf("recovery: tile %d: %w", i, err))
+		}
+		m.recovered[i] = append(m.recovered[i], msg.Values[j])
+	}
+
+	m.turn++
+	if m.turn < len(m.quorum) {
+		return stateRecoverPool
+	}
+	m.turn = 0
+	// Copy the pool, which is part of the transcript.
+	pool := append([][]byte(nil), m.pool...)
+	for _, i := range positions {
+		c, err := sra.CombinePartialDecryptions(m.Params, m.quorum, m.recovered[i])
+		if err != nil {
+			return m.Fail(err)
+		}
+		pool[i] = c
+	}
+	m.pool = pool
+	m.recovered = nil
+	m.logf("removed the keys of player #%d from %d tiles in the pool", departed, len(positions))
+	return nil
+}
+
+// undrawn returns the positions of the tiles still in the pool.
+func (m *Machine) undrawn() []int {
+	var positions []int
+	for i := m.drawn; i < len(m.pool); i++ {
+		positions = append(positions, i)
+	}
+	return positions
+}
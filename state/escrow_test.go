@@ -0,0 +1,157 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"crypto/ed25519"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+func withEscrow(threshold int) func(*Machine) {
+	return func(m *Machine) { m.EscrowThreshold = threshold }
+}
+
+// recoverPool runs RecoverPool for all players but departed.
+func recoverPool(t *testing.T, ms []*Machine, departed int, tamper func(*Message)) ([]*Machine, []error) {
+	t.Helper()
+	var remaining []*Machine
+	for _, m := range ms {
+		if m.whoAmI != departed {
+			remaining = append(remaining, m)
+		}
+	}
+	errs := broadcast(remaining, tamper, func(m *Machine) error {
+		return m.RecoverPool(context.Background(), departed)
+	})
+	return remaining, errs
+}
+
+func TestStateMachineRecoverPool(t *testing.T) {
+	const nPlayers = 3
+	ms, errs := runGame(t, sra.P256, nPlayers, nil, withEscrow(2))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	// Keys of dealt tiles are not escrowed, otherwise opponents could
+	// read the hands.
+	for _, m := range ms {
+		for p, shares := range m.shares {
+			for i := 0; i < m.drawn && i < len(shares); i++ {
+				if shares[i] != nil {
+					t.Fatalf("player #%d holds a share of the key of dealt tile %d of player #%d", m.whoAmI, i, p+1)
+				}
+			}
+		}
+	}
+
+	departed := ms[0].order[0]
+	remaining, errs := recoverPool(t, ms, departed, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", remaining[i].whoAmI, err)
+		}
+	}
+
+	// The remaining players agree on the pool, and can open every tile in
+	// it without the departed player.
+	pool := remaining[0].pool
+	for _, m := range remaining[1:] {
+		if !reflect.DeepEqual(m.pool, pool) {
+			t.Fatalf("player #%d: pool differs from player #%d", m.whoAmI, remaining[0].whoAmI)
+		}
+	}
+	count := make(map[game.Tile]int)
+	for _, m := range ms {
+		for _, tile := range m.hand {
+			count[tile]++
+		}
+	}
+	codec := remaining[0].codec
+	for i := remaining[0].drawn; i < len(pool); i++ {
+		var fps []string
+		for _, m := range remaining {
+			fps = append(fps, m.tileKeys[i].Fingerprint())
+		}
+		ct := game.Sealed(codec, pool[i], fps...)
+		for _, m := range remaining {
+			if err := ct.Open(m.tileKeys[i]); err != nil {
+				t.Fatalf("tile %d: %v", i, err)
+			}
+		}
+		tile, err := ct.Tile()
+		if err != nil {
+			t.Fatalf("tile %d: %v", i, err)
+		}
+		count[*tile]++
+	}
+	want := make(map[game.Tile]int)
+	for _, b := range codec.Deck() {
+		tile, err := codec.DecodeTile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[tile]++
+	}
+	if !reflect.DeepEqual(count, want) {
+		t.Errorf("hands and recovered pool do not form a deck:\ngot  %v\nwant %v", count, want)
+	}
+
+	if err := remaining[0].RecoverPool(context.Background(), departed); err == nil {
+		t.Errorf("recovering the same player twice: want error")
+	}
+}
+
+func TestStateMachineRecoverPoolForged(t *testing.T) {
+	const nPlayers = 3
+	ms, errs := runGame(t, sra.P256, nPlayers, nil, withEscrow(2))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	departed := ms[0].order[0]
+	var culpritKey ed25519.PublicKey
+	remaining, errs := recoverPool(t, ms, departed, func(msg *Message) {
+		if culpritKey != nil {
+			return
+		}
+		culpritKey = msg.From
+		var rm recoverMessage
+		decodeMessage(t, msg, &rm)
+		rm.Values[0], rm.Values[1] = rm.Values[1], rm.Values[0]
+		encodeMessage(t, msg, rm)
+	})
+	culprit := remaining[0].Player(culpritKey)
+	for i, err := range errs {
+		var perr *ProtocolError
+		if !errors.As(err, &perr) {
+			t.Errorf("player #%d: got error %v, want ProtocolError", remaining[i].whoAmI, err)
+			continue
+		}
+		if perr.Player != culprit {
+			t.Errorf("player #%d: blamed player #%d, want #%d", remaining[i].whoAmI, perr.Player, culprit)
+		}
+		if !errors.Is(err, sra.ErrInvalidProof) {
+			t.Errorf("player #%d: got %v, want %v", remaining[i].whoAmI, err, sra.ErrInvalidProof)
+		}
+	}
+}
+
+func TestStateMachineInvalidEscrowThreshold(t *testing.T) {
+	for _, threshold := range []int{-1, 2} {
+		m, _ := newPeers(t, 2, 1)
+		m.In = make(chan Message)
+		m.Out = make(chan Message)
+		m.EscrowThreshold = threshold
+		if err := m.Run(); err == nil {
+			t.Errorf("EscrowThreshold = %d: want error", threshold)
+		}
+	}
+}
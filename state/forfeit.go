@@ -0,0 +1,230 @@
+package state
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/timelock"
+)
+
+// A Forfeit is evidence that a player did not reveal their secret for the
+// gameplay order, or for JointRandom, within the timeout, signed by the player
+// who judged it.
+type Forfeit struct {
+	GameID string
+	// Phase is the phase of the commitment, see commit.Domain.
+	Phase string
+	// Player is the player who forfeited.
+	Player int
+	// Commitment is the unopened commitment of Player to their secret.
+	Commitment commit.Commitment
+	// Judge is the player who waited for the secret.
+	Judge   int
+	Timeout time.Duration
+	// PublicKey is the identity of Judge, and Signature their Ed25519
+	// signature of the other fields but Puzzle.
+	PublicKey ed25519.PublicKey
+	Signature []byte
+	// Puzzle is the time-lock puzzle published by Player, if it does not
+	// unlock to an opening of Commitment. It is evidence that Player
+	// cheated, which anyone can check by solving it. Its secret counts as
+	// zero in the gameplay order.
+	Puzzle *timelock.Puzzle
+}
+
+// errForfeitSignature is returned by Forfeit.Verify for invalid signatures.
+var errForfeitSignature = errors.New("invalid forfeit signature")
+
+// Verify checks the signature of f.
+func (f *Forfeit) Verify() error {
+	if len(f.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(f.PublicKey, f.message(), f.Signature) {
+		return errForfeitSignature
+	}
+	return nil
+}
+
+// message returns the signed part of f.
+func (f *Forfeit) message() []byte {
+	var b bytes.Buffer
+	b.WriteString("tiwe/state forfeit\x00")
+	writeBytes(&b, []byte(f.GameID))
+	writeBytes(&b, []byte(f.Phase))
+	var x [8]byte
+	for _, v := range []uint64{uint64(f.Player), uint64(f.Judge), uint64(f.Timeout)} {
+		binary.BigEndian.PutUint64(x[:], v)
+		b.Write(x[:])
+	}
+	b.Write(f.Commitment[:])
+	return b.Bytes()
+}
+
+// A verdictMessage is sent by the judge of a reveal in the gameplay order
+// phase or in JointRandom, when RevealTimeout is set. Forfeit is nil if the
+// secret was revealed in time.
+type verdictMessage struct {
+	Forfeit *Forfeit
+}
+
+// Forfeits returns the evidence of every player who forfeited the gameplay
+// order or a run of JointRandom by not revealing their secret in time.
+func (m *Machine) Forfeits() []Forfeit {
+	return m.forfeits
+}
+
+// judge returns the player who judges whether player reveals their secret for
+// the gameplay order in time: the next player in the implicit order.
+func (m *Machine) judge(player int) int {
+	return player%m.nPlayers + 1
+}
+
+// recvOpening receives the opening of the commitment c of d.Player to their
+// secret, when RevealTimeout is set. The judge waits at most RevealTimeout for
+// the opening, and then publishes its verdict. An opening received after a
+// forfeit is discarded, and a forfeit received after the opening is a protocol
+// error of the judge, such that all players agree and the judge cannot condemn
+// a player who revealed. recvOpening returns the opening, or the evidence of
+// the forfeit if d.Player did not reveal in time.
+func (m *Machine) recvOpening(d commit.Domain, c commit.Commitment, judge int) (*commit.Opening, *Forfeit, error) {
+	player := d.Player
+	var timeout <-chan time.Time
+	if m.whoAmI == judge {
+		t := time.NewTimer(m.RevealTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var opening *commit.Opening
+	expired := false
+	for {
+		var msg Message
+		var ok bool
+		if expired {
+			// Messages already received come first, such that the
+			// judge does not condemn a player who revealed.
+			select {
+			case msg, ok = <-m.In:
+			default:
+				expired = false
+				f, err := m.signForfeit(d, c)
+				if err != nil {
+					return nil, nil, err
+				}
+				m.logf("Out <- player #%d forfeits", player)
+				if err := m.send(verdictMessage{Forfeit: f}); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+		} else {
+			select {
+			case msg, ok = <-m.In:
+			case <-timeout:
+				timeout = nil
+				expired = true
+				continue
+			}
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("expected more messages")
+		}
+		from, err := m.accept(msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case from == 0:
+			continue
+		case from == player && opening == nil:
+			var o commit.Opening
+			if err := m.decode(from, msg.Data, &o); err != nil {
+				return nil, nil, err
+			}
+			opening = &o
+			if timeout != nil || expired {
+				timeout, expired = nil, false
+				m.logf("Out <- player #%d revealed in time", player)
+				if err := m.send(verdictMessage{}); err != nil {
+					return nil, nil, err
+				}
+			}
+		case from == judge:
+			var v verdictMessage
+			if err := m.decode(from, msg.Data, &v); err != nil {
+				return nil, nil, err
+			}
+			if v.Forfeit == nil {
+				if opening == nil {
+					return nil, nil, m.protocolError(judge, fmt.Errorf("accepted missing secret of player #%d", player))
+				}
+				return opening, nil, nil
+			}
+			if opening != nil {
+				return nil, nil, m.protocolError(judge, fmt.Errorf("condemned player #%d after they revealed", player))
+			}
+			if err := m.checkForfeit(v.Forfeit, d, c, judge); err != nil {
+				return nil, nil, m.protocolError(judge, err)
+			}
+			m.logf("In -> player #%d forfeits", player)
+			// Discard the opening if it arrives late.
+			m.late[player]++
+			return nil, v.Forfeit, nil
+		default:
+			return nil, nil, fmt.Errorf("message from unexpected player: got %v, want %v or %v", from, player, judge)
+		}
+	}
+}
+
+// signForfeit returns evidence that d.Player did not open c.
+func (m *Machine) signForfeit(d commit.Domain, c commit.Commitment) (*Forfeit, error) {
+	f := &Forfeit{
+		GameID:     m.GameID,
+		Phase:      d.Phase,
+		Player:     d.Player,
+		Commitment: c,
+		Judge:      m.whoAmI,
+		Timeout:    m.RevealTimeout,
+		PublicKey:  m.Identity.Public().(ed25519.PublicKey),
+	}
+	f.Signature = ed25519.Sign(m.Identity, f.message())
+	return f, nil
+}
+
+// checkForfeit checks that f is evidence, signed by judge, that d.Player did
+// not open c in this game.
+func (m *Machine) checkForfeit(f *Forfeit, d commit.Domain, c commit.Commitment, judge int) error {
+	if f.GameID != m.GameID || f.Phase != d.Phase || f.Player != d.Player || f.Judge != judge || f.Commitment != c || !bytes.Equal(f.PublicKey, m.Players[judge-1]) {
+		return fmt.Errorf("forfeit of player #%d: evidence does not match the game", d.Player)
+	}
+	return f.Verify()
+}
+
+// unlockSecret recovers the opening of the commitment of player, who forfeited,
+// from their time-lock puzzle, and checks it against the commitment.
+func (m *Machine) unlockSecret(player int) (*commit.Opening, error) {
+	b, err := m.puzzles[player-1].Solve(m.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < commit.SaltSize {
+		return nil, fmt.Errorf("time-locked secret too short: %d bytes", len(b))
+	}
+	var o commit.Opening
+	copy(o.Salt[:], b)
+	o.Value = b[commit.SaltSize:]
+	if err := commit.Verify(m.orderDomain(player), m.hs[player-1], o); err != nil {
+		return nil, fmt.Errorf("secret %x: %w", o.Value, err)
+	}
+	if len(o.Value) != 8 {
+		return nil, fmt.Errorf("invalid secret size: got %d, want 8", len(o.Value))
+	}
+	return &o, nil
+}
+
+// lockSecret returns a time-lock puzzle of o.
+func (m *Machine) lockSecret(o commit.Opening) (*timelock.Puzzle, error) {
+	return timelock.Lock(m.Rand, append(o.Salt[:], o.Value...), m.TimeLock)
+}
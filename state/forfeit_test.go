@@ -0,0 +1,268 @@
+package state
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/crypto/timelock"
+)
+
+// delay returns a tamper function for broadcast that holds the n-th message,
+// and the later messages of the same sender, for d, as if the sender were
+// slow. It stores the sender in from. Held messages are then sent again, in
+// order, through the Out channel of *peer.
+func delay(n int, d time.Duration, from *ed25519.PublicKey, peer **Machine) func(*Message) {
+	var (
+		mu       sync.Mutex
+		count    int
+		held     []Message
+		released bool
+	)
+	return func(msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		switch {
+		case count == n:
+			*from = msg.From
+			go func(out chan<- Message) {
+				time.Sleep(d)
+				mu.Lock()
+				defer mu.Unlock()
+				for _, msg := range held {
+					out <- msg
+				}
+				released = true
+			}((*peer).Out)
+		case count > n && !released && bytes.Equal(msg.From, *from):
+		default:
+			return
+		}
+		held = append(held, *msg)
+		msg.From = nil
+	}
+}
+
+func TestStateMachineForfeit(t *testing.T) {
+	const (
+		nPlayers = 3
+		timeout  = 100 * time.Millisecond
+	)
+	for _, timeLock := range []uint64{0, 1000} {
+		timeLock := timeLock
+		name := "without time lock"
+		if timeLock > 0 {
+			name = "with time lock"
+		}
+		t.Run(name, func(t *testing.T) {
+			// Delay the first revealed secret, sent after the
+			// parameters and the commitments to the secrets, with
+			// their time-lock puzzles, until after the verdict.
+			first := 2*nPlayers + 1
+			if timeLock > 0 {
+				first += nPlayers
+			}
+			var culpritKey ed25519.PublicKey
+			var peer *Machine
+			ms, errs := runGame(t, sra.P256, nPlayers, delay(first, 5*timeout, &culpritKey, &peer), func(m *Machine) {
+				m.RevealTimeout = timeout
+				m.TimeLock = timeLock
+				peer = m
+			})
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("player #%d: %v", i+1, err)
+				}
+			}
+			culprit := ms[0].Player(culpritKey)
+			order := ms[0].order
+			for _, m := range ms {
+				if !reflect.DeepEqual(m.order, order) {
+					t.Fatalf("player #%d: order %v, want %v", m.whoAmI, m.order, order)
+				}
+				forfeits := m.Forfeits()
+				if len(forfeits) != 1 || forfeits[0].Player != culprit {
+					t.Fatalf("player #%d: got forfeits %+v, want player #%d", m.whoAmI, forfeits, culprit)
+				}
+				if err := forfeits[0].Verify(); err != nil {
+					t.Errorf("player #%d: %v", m.whoAmI, err)
+				}
+			}
+			if last := order[len(order)-1]; last != culprit {
+				t.Errorf("order %v: player #%d who forfeited is not last", order, culprit)
+			}
+		})
+	}
+}
+
+// TestStateMachineForfeitLate checks that a secret revealed after the verdict
+// of the judge is ignored.
+func TestStateMachineForfeitLate(t *testing.T) {
+	in := make(chan Message, 1)
+	out := make(chan Message, 1)
+	m, peers := newPeers(t, 2, 2)
+	m.In = in
+	m.Out = out
+	m.Params = sra.P256
+	m.RevealTimeout = time.Millisecond
+	p1 := peers[0]
+	id := setupDigest(t, 2, func(m *Machine) {
+		m.Params = sra.P256
+		m.RevealTimeout = time.Millisecond
+	})
+	var verdict verdictMessage
+	go func() {
+		in <- p1.raw(id)
+		in <- <-out
+
+		d := commit.Domain{GameID: m.GameID, Phase: "gameplay order", Player: 1}
+		c, o, err := commit.Commit(nil, d, []byte("secret 1"))
+		if err != nil {
+			t.Error(err)
+		}
+		in <- p1.message(t, c)
+		in <- <-out
+
+		// Player #2 judges player #1, who reveals too late.
+		msg := <-out
+		decodeMessage(t, &msg, &verdict)
+		in <- msg
+		in <- p1.message(t, o)
+
+		// Player #1 judges player #2, who reveals in time.
+		in <- <-out
+		in <- p1.message(t, verdictMessage{})
+
+		close(in)
+	}()
+	if err := m.Run(); err == nil {
+		t.Fatal("got nil error, want error after input closed")
+	}
+	if want := []int{2, 1}; !reflect.DeepEqual(m.order, want) {
+		t.Errorf("gameplay order %v, want %v", m.order, want)
+	}
+	f := verdict.Forfeit
+	if f == nil || f.Player != 1 || f.Judge != 2 {
+		t.Fatalf("got verdict %+v, want forfeit of player #1 judged by player #2", f)
+	}
+	if err := f.Verify(); err != nil {
+		t.Error(err)
+	}
+	f.Timeout++
+	if err := f.Verify(); err == nil {
+		t.Error("Verify of altered forfeit: got nil error")
+	}
+}
+
+// TestStateMachineForfeitInvalidPuzzle checks that a player who forfeits with a
+// time-lock puzzle that does not unlock to their secret is placed last, instead
+// of aborting the game after they could learn the order.
+func TestStateMachineForfeitInvalidPuzzle(t *testing.T) {
+	const (
+		nPlayers = 3
+		timeout  = 100 * time.Millisecond
+	)
+	// The first player commits and publishes their puzzle after the
+	// parameters, and reveals first, after all commitments and puzzles.
+	var n int
+	var cheaterKey, culpritKey ed25519.PublicKey
+	var peer *Machine
+	delayed := delay(3*nPlayers+1, 5*timeout, &culpritKey, &peer)
+	ms, errs := runGame(t, sra.P256, nPlayers, func(msg *Message) {
+		n++
+		if n == nPlayers+2 {
+			cheaterKey = msg.From
+			var p timelock.Puzzle
+			decodeMessage(t, msg, &p)
+			p.Data[0] ^= 1
+			encodeMessage(t, msg, p)
+		}
+		delayed(msg)
+	}, func(m *Machine) {
+		m.RevealTimeout = timeout
+		m.TimeLock = 1000
+		peer = m
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	if !bytes.Equal(cheaterKey, culpritKey) {
+		t.Fatal("tampered puzzle and delayed secret of different players")
+	}
+	culprit := ms[0].Player(culpritKey)
+	for _, m := range ms {
+		if last := m.order[len(m.order)-1]; last != culprit {
+			t.Errorf("player #%d: order %v: player #%d who forfeited is not last", m.whoAmI, m.order, culprit)
+		}
+		forfeits := m.Forfeits()
+		if len(forfeits) != 1 || forfeits[0].Player != culprit || forfeits[0].Puzzle == nil {
+			t.Fatalf("player #%d: got forfeits %+v, want player #%d with their puzzle", m.whoAmI, forfeits, culprit)
+		}
+	}
+}
+
+// TestStateMachineForfeitAfterReveal checks that a judge who condemns a player
+// after they revealed their secret violates the protocol.
+func TestStateMachineForfeitAfterReveal(t *testing.T) {
+	in := make(chan Message, 1)
+	out := make(chan Message, 1)
+	m, peers := newPeers(t, 2, 1)
+	m.In = in
+	m.Out = out
+	m.Params = sra.P256
+	m.RevealTimeout = time.Hour
+	p2 := peers[1]
+	id := setupDigest(t, 2, func(m *Machine) {
+		m.Params = sra.P256
+		m.RevealTimeout = time.Hour
+	})
+	go func() {
+		in <- <-out
+		in <- p2.raw(id)
+
+		msg := <-out
+		var c commit.Commitment
+		decodeMessage(t, &msg, &c)
+		in <- msg
+		d := commit.Domain{GameID: m.GameID, Phase: "gameplay order", Player: 2}
+		c2, _, err := commit.Commit(nil, d, []byte("secret 2"))
+		if err != nil {
+			t.Error(err)
+		}
+		in <- p2.message(t, c2)
+
+		// Player #2 judges player #1, who reveals in time, and
+		// condemns them anyway.
+		in <- <-out
+		f := &Forfeit{
+			GameID:     m.GameID,
+			Player:     1,
+			Commitment: c,
+			Judge:      2,
+			Timeout:    m.RevealTimeout,
+			PublicKey:  p2.key.Public().(ed25519.PublicKey),
+		}
+		f.Signature = ed25519.Sign(p2.key, f.message())
+		in <- p2.message(t, verdictMessage{Forfeit: f})
+
+		close(in)
+	}()
+	err := m.Run()
+	var perr *ProtocolError
+	if !errors.As(err, &perr) || perr.Player != 2 {
+		t.Fatalf("got error %v, want ProtocolError of player #2", err)
+	}
+	if want := "after they revealed"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want substring %q", err, want)
+	}
+}
@@ -0,0 +1,346 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+// A moveMessage is the payload of messages in the gameplay phase. The sender
+// publishes the board after their move, and opens the tiles they played from
+// their hand: the tile at each position in the pool decrypted with their key,
+// with a proof that the decryption used the key they committed to.
+type moveMessage struct {
+	Board     game.Board
+	Positions []int
+	Values    [][]byte
+	Proofs    [][]byte
+	// Draw is set for a move that plays no tiles, in which the sender
+	// draws the next tile from the pool, or passes if the pool is empty.
+	// The other fields are empty.
+	Draw bool
+}
+
+// Board returns the tiles on the table.
+func (m *Machine) Board() game.Board {
+	return m.board
+}
+
+// Hand returns the tiles in the hand of this player.
+func (m *Machine) Hand() []game.Tile {
+	return append([]game.Tile(nil), m.hand...)
+}
+
+// Current returns the player whose move is next, in gameplay order, skipping
+// players who left the game.
+func (m *Machine) Current() int {
+	for k := range m.order {
+		p := m.order[(m.mover+k)%len(m.order)]
+		if !m.departed[p] {
+			return p
+		}
+	}
+	return 0
+}
+
+// PoolSize returns the number of tiles left in the pool.
+func (m *Machine) PoolSize() int {
+	return len(m.pool) - m.drawn
+}
+
+// Winner returns the remaining player who played all their tiles, or 0 if
+// there is none.
+func (m *Machine) Winner() int {
+	if m.hand == nil {
+		return 0
+	}
+	held := make(map[int]int)
+	for i := range m.partial {
+		if !m.opened[i] {
+			held[m.owner(i)]++
+		}
+	}
+	for _, p := range m.order {
+		if !m.departed[p] && held[p] == 0 {
+			return p
+		}
+	}
+	return 0
+}
+
+// Blocked reports whether the pool is empty and every remaining player passed
+// since the last move playing tiles, such that nobody can play, as in
+// game.Game.Blocked.
+func (m *Machine) Blocked() bool {
+	if m.hand == nil || m.PoolSize() > 0 {
+		return false
+	}
+	for _, p := range m.order {
+		if !m.departed[p] && !m.passed[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// Over reports whether the round is over, because a player won or the game is
+// blocked.
+func (m *Machine) Over() bool {
+	return m.Winner() != 0 || m.Blocked()
+}
+
+// Play runs a move of the gameplay phase. The current player publishes board,
+// the board after their move, and opens the tiles they played from their hand.
+// Every player checks the move with Rules.ValidateTurn, against the tiles
+// opened, such that no player can remove or forge tiles on the table, or break
+// the initial meld rule.
+//
+// If board is nil, the current player plays no tiles: they draw the next tile
+// from the pool, which every other remaining player reveals to them as in the
+// deal, or pass if the pool is empty, as in game.Game.Draw and game.Game.Pass.
+//
+// Play must be called by all remaining players after Run, once per move, until
+// the round is over, see Over. Only the board of the current player is used,
+// the others may pass nil. An invalid board of the current player is rejected
+// before publishing it, without failing the machine. Play returns
+// game.ErrOver if the round is over.
+func (m *Machine) Play(ctx context.Context, board game.Board) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.hand == nil {
+		return errors.New("cannot play: game not dealt")
+	}
+	if m.Over() {
+		return game.ErrOver
+	}
+	m.move = nil
+	if m.whoAmI == m.Current() && board == nil {
+		m.move = &moveMessage{Draw: true}
+	} else if m.whoAmI == m.Current() {
+		move, err := m.prepareMove(board)
+		if err != nil {
+			return err
+		}
+		m.move = move
+	}
+	m.ctx = ctx
+	for state := stateMove; state != nil; {
+		state = state(m)
+	}
+	return m.Err()
+}
+
+// prepareMove returns the message opening the tiles played to change the board
+// to board.
+func (m *Machine) prepareMove(board game.Board) (*moveMessage, error) {
+	played, err := m.Rules.ValidateTurn(m.board, board, m.hand, m.melded[m.whoAmI])
+	if err != nil {
+		return nil, err
+	}
+	msg := &moveMessage{Board: board}
+	used := make(map[int]bool)
+	for _, t := range played {
+		for k, tile := range m.hand {
+			if used[k] || tile != t && !(tile.IsJoker() && t.IsJoker()) {
+				continue
+			}
+			used[k] = true
+			i := m.handPositions[k]
+			key := m.tileKeys[i]
+			value, err := key.Decrypt(m.partial[i])
+			if err != nil {
+				return nil, err
+			}
+			proof, err := key.ProveDecryption(m.Rand, m.partial[i], value)
+			if err != nil {
+				return nil, err
+			}
+			msg.Positions = append(msg.Positions, i)
+			msg.Values = append(msg.Values, value)
+			msg.Proofs = append(msg.Proofs, proof)
+			break
+		}
+	}
+	return msg, nil
+}
+
+// stateMove lets the current player publish their move, and checks it.
+func stateMove(m *Machine) Fn {
+	player := m.Current()
+
+	if m.whoAmI == player {
+		if m.move.Draw {
+			m.logf("Out <- move drawing a tile")
+		} else {
+			m.logf("Out <- move playing %d tiles", len(m.move.Positions))
+		}
+		if err := m.send(m.move); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var msg moveMessage
+	if err := m.recv(player, &msg); err != nil {
+		return m.Fail(err)
+	}
+	if msg.Draw {
+		m.logf("In -> move drawing a tile")
+		if msg.Board != nil || msg.Positions != nil || msg.Values != nil || msg.Proofs != nil {
+			return m.Violation(player, errors.New("drew a tile with a board or opened tiles"))
+		}
+		return m.startDraw(player)
+	}
+	m.logf("In -> move playing %d tiles", len(msg.Positions))
+	if len(msg.Values) != len(msg.Positions) || len(msg.Proofs) != len(msg.Positions) {
+		return m.Violation(player, fmt.Errorf("opened %d tiles with %d values and %d proofs", len(msg.Positions), len(msg.Values), len(msg.Proofs)))
+	}
+	tiles := make([]game.Tile, len(msg.Positions))
+	seen := make(map[int]bool)
+	for j, i := range msg.Positions {
+		if i < 0 || i >= len(m.partial) || m.owner(i) != player {
+			return m.Violation(player, fmt.Errorf("opened tile %d not dealt to them", i))
+		}
+		if m.opened[i] || seen[i] {
+			return m.Violation(player, fmt.Errorf("opened tile %d already played", i))
+		}
+		seen[i] = true
+		if err := m.verifyReveal(player, i, msg.Values[j], msg.Proofs[j]); err != nil {
+			return m.Violation(player, fmt.Errorf("tile %d: %w", i, err))
+		}
+		tile, err := m.codec.DecodeTile(msg.Values[j])
+		if err != nil {
+			return m.Violation(player, fmt.Errorf("tile %d: %w", i, err))
+		}
+		tiles[j] = tile
+	}
+	played, err := m.Rules.ValidateTurn(m.board, msg.Board, tiles, m.melded[player])
+	if err != nil {
+		return m.Violation(player, err)
+	}
+	if len(played) != len(tiles) {
+		return m.Violation(player, fmt.Errorf("opened %d tiles, played %d", len(tiles), len(played)))
+	}
+
+	m.board = msg.Board
+	if m.opened == nil {
+		m.opened = make(map[int]bool)
+		m.melded = make(map[int]bool)
+	}
+	m.melded[player] = true
+	m.passed = nil
+	for _, i := range msg.Positions {
+		m.opened[i] = true
+	}
+	if m.whoAmI == player {
+		m.removeFromHand(msg.Positions)
+	}
+	m.endMove(player)
+	return nil
+}
+
+// startDraw lets player draw the next tile from the pool, or pass if the pool
+// is empty.
+func (m *Machine) startDraw(player int) Fn {
+	if m.PoolSize() == 0 {
+		m.logf("player #%d passed", player)
+		if m.passed == nil {
+			m.passed = make(map[int]bool)
+		}
+		m.passed[player] = true
+		m.endMove(player)
+		return nil
+	}
+	m.drawers = append(m.drawers, player)
+	m.partial = append(m.partial, m.pool[m.drawn])
+	m.drawn++
+	m.turn = 0
+	return stateDrawTile
+}
+
+// stateDrawTile lets each other remaining player, in gameplay order, reveal
+// their decryption of the tile drawn by the current player, who then decrypts
+// it.
+func stateDrawTile(m *Machine) Fn {
+	i := len(m.partial) - 1
+	drawer := m.owner(i)
+	if m.turn == len(m.order) {
+		m.turn = 0
+		if m.whoAmI == drawer {
+			tile, err := m.openTile(i)
+			if err != nil {
+				return m.Fail(err)
+			}
+			m.hand = append(m.hand, tile)
+			m.handPositions = append(m.handPositions, i)
+			m.logf("drew %v", tile)
+		}
+		m.endMove(drawer)
+		return nil
+	}
+	player := m.order[m.turn]
+	m.turn++
+	if player == drawer || m.departed[player] {
+		return stateDrawTile
+	}
+
+	if m.whoAmI == player {
+		key := m.tileKeys[i]
+		value, err := key.Decrypt(m.partial[i])
+		if err != nil {
+			return m.Fail(err)
+		}
+		proof, err := key.ProveDecryption(m.Rand, m.partial[i], value)
+		if err != nil {
+			return m.Fail(err)
+		}
+		m.logf("Out <- revealed tile %d", i)
+		if err := m.send(revealMessage{Values: [][]byte{value}, Proofs: [][]byte{proof}}); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var msg revealMessage
+	if err := m.recv(player, &msg); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> revealed tile %d", i)
+	if len(msg.Values) != 1 || len(msg.Proofs) != 1 {
+		return m.Violation(player, fmt.Errorf("revealed %d tiles with %d proofs, want 1", len(msg.Values), len(msg.Proofs)))
+	}
+	if err := m.verifyReveal(player, i, msg.Values[0], msg.Proofs[0]); err != nil {
+		return m.Violation(player, fmt.Errorf("drawn tile %d: %w", i, err))
+	}
+	m.partial[i] = msg.Values[0]
+	return stateDrawTile
+}
+
+// endMove passes the move to the player after player in gameplay order.
+func (m *Machine) endMove(player int) {
+	for k, p := range m.order {
+		if p == player {
+			m.mover = (k + 1) % len(m.order)
+		}
+	}
+}
+
+// removeFromHand removes the tiles at the given positions in the pool from the
+// hand.
+func (m *Machine) removeFromHand(positions []int) {
+	remove := make(map[int]bool, len(positions))
+	for _, i := range positions {
+		remove[i] = true
+	}
+	// The hand is empty but not nil after the last tile is played.
+	hand := make([]game.Tile, 0, len(m.hand))
+	handPositions := make([]int, 0, len(m.handPositions))
+	for k, i := range m.handPositions {
+		if !remove[i] {
+			hand = append(hand, m.hand[k])
+			handPositions = append(handPositions, i)
+		}
+	}
+	m.hand, m.handPositions = hand, handPositions
+}
@@ -0,0 +1,326 @@
+package state
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+// findSet returns a valid set of three tiles from hand, or nil.
+func findSet(hand []game.Tile) []game.Tile {
+	perms := [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	for a := range hand {
+		for b := a + 1; b < len(hand); b++ {
+			for c := b + 1; c < len(hand); c++ {
+				tiles := [3]game.Tile{hand[a], hand[b], hand[c]}
+				for _, p := range perms {
+					set := []game.Tile{tiles[p[0]], tiles[p[1]], tiles[p[2]]}
+					if (game.Board{set}).Valid() {
+						return set
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// newPlayable runs games until the first player in gameplay order can play a
+// set from their hand, and returns the machines and the set. The machines have
+// no initial meld threshold, such that any set can be played.
+func newPlayable(t *testing.T) ([]*Machine, []game.Tile) {
+	t.Helper()
+	for seed := byte(0); seed < 10; seed++ {
+		ms, errs := runGameSeed(t, sra.P256, 3, []byte{seed}, nil)
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("player #%d: %v", i+1, err)
+			}
+		}
+		mover := ms[ms[0].Current()-1]
+		if set := findSet(mover.Hand()); set != nil {
+			for _, m := range ms {
+				m.Rules = &game.Rules{}
+			}
+			return ms, set
+		}
+	}
+	t.Fatal("no game in which the first player has a set")
+	return nil, nil
+}
+
+// play runs Play for all machines, with board as the move of the current
+// player.
+func play(ms []*Machine, board game.Board, tamper func(*Message)) []error {
+	current := ms[0].Current()
+	return broadcast(ms, tamper, func(m *Machine) error {
+		if m.whoAmI != current {
+			return m.Play(context.Background(), nil)
+		}
+		return m.Play(context.Background(), board)
+	})
+}
+
+func TestStateMachinePlay(t *testing.T) {
+	ms, set := newPlayable(t)
+	mover := ms[0].Current()
+	m := ms[mover-1]
+
+	// Invalid boards are rejected before publishing them.
+	if err := m.Play(context.Background(), game.Board{set[:2]}); !errors.Is(err, game.ErrInvalidBoard) {
+		t.Fatalf("got error %v, want %v", err, game.ErrInvalidBoard)
+	}
+	m.Rules.InitialMeld = game.Points(set) + 1
+	if err := m.Play(context.Background(), game.Board{}.Add(set...)); !errors.Is(err, game.ErrInitialMeld) {
+		t.Fatalf("got error %v, want %v", err, game.ErrInitialMeld)
+	}
+	m.Rules.InitialMeld = 0
+	if err := m.Err(); err != nil {
+		t.Fatalf("invalid board failed the machine: %v", err)
+	}
+
+	board := game.Board{}.Add(set...)
+	for i, err := range play(ms, board, nil) {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	for _, m := range ms {
+		if !reflect.DeepEqual(m.Board(), board) {
+			t.Errorf("player #%d: board %v, want %v", m.whoAmI, m.Board(), board)
+		}
+		if m.Current() == mover {
+			t.Errorf("player #%d: player #%d moves again", m.whoAmI, mover)
+		}
+	}
+	if n := len(m.Hand()); n != handSize-len(set) {
+		t.Errorf("hand has %d tiles after move, want %d", n, handSize-len(set))
+	}
+}
+
+func TestStateMachinePlayForged(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, msg *moveMessage)
+		want   string
+	}{
+		{
+			name: "tile not opened",
+			tamper: func(t *testing.T, msg *moveMessage) {
+				msg.Positions = msg.Positions[1:]
+				msg.Values = msg.Values[1:]
+				msg.Proofs = msg.Proofs[1:]
+			},
+			want: game.ErrNotInHand.Error(),
+		},
+		{
+			name: "tile opened but not played",
+			tamper: func(t *testing.T, msg *moveMessage) {
+				msg.Board = nil
+			},
+			want: game.ErrNoTilePlayed.Error(),
+		},
+		{
+			name: "wrong proof",
+			tamper: func(t *testing.T, msg *moveMessage) {
+				msg.Proofs[0], msg.Proofs[1] = msg.Proofs[1], msg.Proofs[0]
+			},
+			want: sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "tile of another player",
+			tamper: func(t *testing.T, msg *moveMessage) {
+				msg.Positions[0] = (msg.Positions[0] + handSize) % (3 * handSize)
+			},
+			want: "not dealt to them",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, set := newPlayable(t)
+			var culpritKey ed25519.PublicKey
+			errs := play(ms, game.Board{}.Add(set...), func(msg *Message) {
+				culpritKey = msg.From
+				var mm moveMessage
+				decodeMessage(t, msg, &mm)
+				tt.tamper(t, &mm)
+				encodeMessage(t, msg, mm)
+			})
+			culprit := ms[0].Player(culpritKey)
+			for i, err := range errs {
+				var perr *ProtocolError
+				if !errors.As(err, &perr) {
+					t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+					continue
+				}
+				if perr.Player != culprit {
+					t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+				}
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayBeforeDeal(t *testing.T) {
+	m := &Machine{nPlayers: 2, whoAmI: 1}
+	if err := m.Play(context.Background(), nil); err == nil {
+		t.Error("got nil error, want error")
+	}
+}
+
+// newDealt runs a game and returns the machines after the deal.
+func newDealt(t *testing.T) []*Machine {
+	t.Helper()
+	ms, errs := runGame(t, sra.P256, 3, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	return ms
+}
+
+func TestStateMachineDraw(t *testing.T) {
+	ms := newDealt(t)
+	mover := ms[0].Current()
+	size := ms[0].PoolSize()
+	for i, err := range play(ms, nil, nil) {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	for _, m := range ms {
+		want := handSize
+		if m.whoAmI == mover {
+			want++
+		}
+		if n := len(m.Hand()); n != want {
+			t.Errorf("player #%d: hand has %d tiles, want %d", m.whoAmI, n, want)
+		}
+		if n := m.PoolSize(); n != size-1 {
+			t.Errorf("player #%d: pool has %d tiles, want %d", m.whoAmI, n, size-1)
+		}
+		if m.Current() == mover {
+			t.Errorf("player #%d: player #%d moves again", m.whoAmI, mover)
+		}
+		if m.Over() {
+			t.Errorf("player #%d: round over after a draw", m.whoAmI)
+		}
+	}
+	m := ms[mover-1]
+	if i := m.handPositions[handSize]; m.owner(i) != mover {
+		t.Errorf("drawn tile %d owned by player #%d, want #%d", i, m.owner(i), mover)
+	}
+}
+
+func TestStateMachineDrawForged(t *testing.T) {
+	tests := []struct {
+		name   string
+		seq    int // index of the tampered message in the move
+		tamper func(t *testing.T, msg *Message)
+		want   string
+	}{
+		{
+			name: "draw with board",
+			seq:  0,
+			tamper: func(t *testing.T, msg *Message) {
+				var mm moveMessage
+				decodeMessage(t, msg, &mm)
+				mm.Board = game.Board{{game.Joker}}
+				encodeMessage(t, msg, mm)
+			},
+			want: "drew a tile with a board",
+		},
+		{
+			name: "reveal not decrypted",
+			seq:  1,
+			tamper: func(t *testing.T, msg *Message) {
+				var rm revealMessage
+				decodeMessage(t, msg, &rm)
+				rm.Values[0] = append([]byte(nil), rm.Values[0]...)
+				rm.Values[0][len(rm.Values[0])-1] ^= 1
+				encodeMessage(t, msg, rm)
+			},
+			want: "drawn tile",
+		},
+		{
+			name: "reveal missing",
+			seq:  1,
+			tamper: func(t *testing.T, msg *Message) {
+				encodeMessage(t, msg, revealMessage{})
+			},
+			want: "revealed 0 tiles with 0 proofs, want 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newDealt(t)
+			var culpritKey ed25519.PublicKey
+			n := 0
+			errs := play(ms, nil, func(msg *Message) {
+				if n == tt.seq {
+					culpritKey = msg.From
+					tt.tamper(t, msg)
+				}
+				n++
+			})
+			culprit := ms[0].Player(culpritKey)
+			for i, err := range errs {
+				var perr *ProtocolError
+				if !errors.As(err, &perr) {
+					t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+					continue
+				}
+				if perr.Player != culprit {
+					t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+				}
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStateMachinePass(t *testing.T) {
+	ms := newDealt(t)
+	// Empty the pool.
+	for _, m := range ms {
+		m.drawn = len(m.pool)
+	}
+	for k := range ms {
+		for _, m := range ms {
+			if m.Blocked() {
+				t.Fatalf("player #%d: blocked after %d passes", m.whoAmI, k)
+			}
+		}
+		for i, err := range play(ms, nil, nil) {
+			if err != nil {
+				t.Fatalf("pass %d: player #%d: %v", k+1, i+1, err)
+			}
+		}
+	}
+	for _, m := range ms {
+		if !m.Blocked() || !m.Over() {
+			t.Errorf("player #%d: not blocked after every player passed", m.whoAmI)
+		}
+		if w := m.Winner(); w != 0 {
+			t.Errorf("player #%d: winner #%d in a blocked round", m.whoAmI, w)
+		}
+		if n := len(m.Hand()); n != handSize {
+			t.Errorf("player #%d: hand has %d tiles after passing, want %d", m.whoAmI, n, handSize)
+		}
+		if err := m.Play(context.Background(), nil); !errors.Is(err, game.ErrOver) {
+			t.Errorf("player #%d: got error %v, want %v", m.whoAmI, err, game.ErrOver)
+		}
+	}
+}
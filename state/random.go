@@ -0,0 +1,221 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"golang.org/x/crypto/blake2b"
+)
+
+// JointRandomSize is the size of the output of JointRandom, and of the secret
+// contributed by each player.
+const JointRandomSize = 32
+
+// A jointRound is the state of a run of JointRandom.
+type jointRound struct {
+	label       string
+	players     []int // contributing players, in implicit order
+	opening     commit.Opening
+	commitments []commit.Commitment
+	values      [][]byte // revealed secrets, nil for forfeits
+	out         []byte
+}
+
+// JointRandom runs the joint randomness sub-protocol, returning
+// JointRandomSize bytes that no player can predict, as long as one player is
+// honest. Every remaining player, in the implicit order, commits to a random
+// secret, and after all commitments every player reveals their secret. The
+// output is the BLAKE2b-256 hash of the label and all secrets. Rolls and Intn
+// derive values from the output, such as dice rolls and tie-breaks.
+//
+// If RevealTimeout is set, each reveal is judged by the next remaining player
+// in the implicit order, as in the gameplay order phase. A player who does not
+// reveal in time forfeits, Forfeits returns signed evidence, and the output is
+// derived from the secrets of the other players. The output is unbiased only
+// if every player reveals: the last player to reveal learns the output first,
+// and can choose between two outputs at the cost of a forfeit. If
+// RevealTimeout is zero, players wait forever for each reveal.
+//
+// JointRandom must be called by all remaining players with the same label,
+// which identifies what the output is used for. Since it does not depend on
+// the gameplay order, it can be called before Run, for example to decide who
+// starts, as well as after Run. It can be called any number of times; each
+// call produces an independent output.
+func (m *Machine) JointRandom(ctx context.Context, label string) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if err := m.setup(); err != nil {
+		return nil, err
+	}
+	m.ctx = ctx
+	m.turn = 0
+	m.joint = &jointRound{label: label}
+	for p := 1; p <= m.nPlayers; p++ {
+		if !m.departed[p] {
+			m.joint.players = append(m.joint.players, p)
+		}
+	}
+	for state := stateJointCommit; state != nil; {
+		state = state(m)
+	}
+	m.jointRounds++
+	if err := m.Err(); err != nil {
+		return nil, err
+	}
+	return m.joint.out, nil
+}
+
+// stateJointCommit lets each player commit to their secret.
+func stateJointCommit(m *Machine) Fn {
+	j := m.joint
+	player := j.players[m.turn]
+
+	if m.whoAmI == player {
+		v := make([]byte, JointRandomSize)
+		if _, err := io.ReadFull(m.Rand, v); err != nil {
+			return m.Fail(err)
+		}
+		c, o, err := commit.Commit(m.Rand, m.jointDomain(player), v)
+		if err != nil {
+			return m.Fail(err)
+		}
+		j.opening = o
+		m.logf("Out <- %x", c)
+		if err := m.send(c); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var c commit.Commitment
+	if err := m.recv(player, &c); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> %x", c)
+	j.commitments = append(j.commitments, c)
+
+	m.turn++
+	if m.turn == len(j.players) {
+		m.turn = 0
+		return stateJointReveal
+	}
+	return stateJointCommit
+}
+
+// stateJointReveal lets each player reveal their secret.
+func stateJointReveal(m *Machine) Fn {
+	j := m.joint
+	player := j.players[m.turn]
+
+	if m.whoAmI == player {
+		m.logf("Out <- %x", j.opening.Value)
+		if err := m.send(j.opening); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	o := new(commit.Opening)
+	if m.RevealTimeout > 0 {
+		judge := j.players[(m.turn+1)%len(j.players)]
+		var f *Forfeit
+		var err error
+		if o, f, err = m.recvOpening(m.jointDomain(player), j.commitments[m.turn], judge); err != nil {
+			return m.Fail(err)
+		}
+		if f != nil {
+			m.forfeits = append(m.forfeits, *f)
+			j.values = append(j.values, nil)
+			return m.nextJointReveal()
+		}
+	} else if err := m.recv(player, o); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> %x", o.Value)
+	if err := commit.Verify(m.jointDomain(player), j.commitments[m.turn], *o); err != nil {
+		return m.Violation(player, fmt.Errorf("joint random %q: %w", j.label, err))
+	}
+	if len(o.Value) != JointRandomSize {
+		return m.Violation(player, fmt.Errorf("joint random %q: invalid secret size: got %d, want %d", j.label, len(o.Value), JointRandomSize))
+	}
+	j.values = append(j.values, o.Value)
+	return m.nextJointReveal()
+}
+
+// nextJointReveal returns the next state after a secret for JointRandom is
+// revealed or forfeited, and computes the output after the last one.
+func (m *Machine) nextJointReveal() Fn {
+	j := m.joint
+	m.turn++
+	if m.turn < len(j.players) {
+		return stateJointReveal
+	}
+	m.turn = 0
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/state joint random\x00"))
+	writeBytes(h, []byte(m.GameID))
+	writeBytes(h, []byte(j.label))
+	for _, v := range j.values {
+		// Forfeits are empty, such that the output depends on who
+		// forfeited.
+		writeBytes(h, v)
+	}
+	j.out = h.Sum(nil)
+	m.logf("joint random %q: %x", j.label, j.out)
+	return nil
+}
+
+// jointDomain returns the domain of the commitment of player to its secret in
+// the current run of JointRandom. The number of previous runs makes every
+// commitment unique within a game.
+func (m *Machine) jointDomain(player int) commit.Domain {
+	return commit.Domain{
+		GameID: m.GameID,
+		Phase:  fmt.Sprintf("joint random #%d %q", m.jointRounds, m.joint.label),
+		Player: player,
+	}
+}
+
+// writeBytes writes b prefixed with its length.
+func writeBytes(w io.Writer, b []byte) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+	w.Write(l[:])
+	w.Write(b)
+}
+
+// Intn returns a uniform number in [0,n) derived from the output r of
+// JointRandom, and from what, which distinguishes values derived from the same
+// output. It panics if n <= 0.
+func Intn(r []byte, what string, n int) int {
+	if n <= 0 {
+		panic("state: invalid argument to Intn")
+	}
+	// Reject values in the incomplete last interval to avoid bias.
+	max := ^uint64(0) - ^uint64(0)%uint64(n)
+	for counter := uint64(0); ; counter++ {
+		h, _ := blake2b.New256(nil)
+		h.Write([]byte("tiwe/state intn\x00"))
+		writeBytes(h, r)
+		writeBytes(h, []byte(what))
+		var c [8]byte
+		binary.BigEndian.PutUint64(c[:], counter)
+		h.Write(c[:])
+		if v := binary.BigEndian.Uint64(h.Sum(nil)); v < max {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// Rolls returns a roll of a die with the given number of sides for each of
+// nPlayers players, derived from the output r of JointRandom. Rolls[i] is the
+// roll of player i+1, in the range [1,sides].
+func Rolls(r []byte, nPlayers, sides int) []int {
+	rolls := make([]int, nPlayers)
+	for i := range rolls {
+		rolls[i] = 1 + Intn(r, fmt.Sprintf("roll %d", i+1), sides)
+	}
+	return rolls
+}
@@ -0,0 +1,166 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"crypto/ed25519"
+
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+)
+
+// jointRandom runs JointRandom for all machines.
+func jointRandom(ms []*Machine, label string, tamper func(*Message)) ([][]byte, []error) {
+	outs := make([][]byte, len(ms))
+	errs := broadcast(ms, tamper, func(m *Machine) error {
+		out, err := m.JointRandom(context.Background(), label)
+		outs[m.whoAmI-1] = out
+		return err
+	})
+	return outs, errs
+}
+
+func TestJointRandom(t *testing.T) {
+	ms := newGame(t, sra.P256, 3, nil)
+	var prev []byte
+	for i := 0; i < 3; i++ {
+		outs, errs := jointRandom(ms, "who starts", nil)
+		for j, err := range errs {
+			if err != nil {
+				t.Fatalf("player #%d: %v", j+1, err)
+			}
+		}
+		for j, out := range outs {
+			if len(out) != JointRandomSize {
+				t.Fatalf("player #%d: got %d bytes, want %d", j+1, len(out), JointRandomSize)
+			}
+			if !bytes.Equal(out, outs[0]) {
+				t.Fatalf("player #%d: got %x, want %x", j+1, out, outs[0])
+			}
+		}
+		if bytes.Equal(outs[0], prev) {
+			t.Errorf("run %d: output repeated", i)
+		}
+		prev = outs[0]
+	}
+}
+
+func TestJointRandomForged(t *testing.T) {
+	ms := newGame(t, sra.P256, 3, nil)
+	// Tamper with the first revealed secret, sent after the commitments.
+	var n int
+	var culpritKey ed25519.PublicKey
+	_, errs := jointRandom(ms, "tie-break", func(msg *Message) {
+		n++
+		if n != len(ms)+1 {
+			return
+		}
+		culpritKey = msg.From
+		var o commit.Opening
+		decodeMessage(t, msg, &o)
+		o.Value[0] ^= 1
+		encodeMessage(t, msg, o)
+	})
+	culprit := ms[0].Player(culpritKey)
+	for i, err := range errs {
+		var perr *ProtocolError
+		if !errors.As(err, &perr) || perr.Player != culprit || !errors.Is(err, commit.ErrInvalidOpening) {
+			t.Errorf("player #%d: got error %v, want %v blaming player #%d", i+1, err, commit.ErrInvalidOpening, culprit)
+		}
+	}
+}
+
+// TestJointRandomBeforeRun checks that JointRandom works before the gameplay
+// order is decided, and that the game goes on after it.
+func TestJointRandomBeforeRun(t *testing.T) {
+	ms := newGame(t, sra.P256, 3, nil)
+	before, errs := jointRandom(ms, "who starts", nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: JointRandom before Run: %v", i+1, err)
+		}
+	}
+	for i, err := range broadcast(ms, nil, (*Machine).Run) {
+		if err != nil {
+			t.Fatalf("player #%d: Run: %v", i+1, err)
+		}
+	}
+	after, errs := jointRandom(ms, "who starts", nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: JointRandom after Run: %v", i+1, err)
+		}
+	}
+	for i := range ms {
+		if !bytes.Equal(before[i], before[0]) || !bytes.Equal(after[i], after[0]) {
+			t.Fatalf("player #%d: outputs differ from player #1", i+1)
+		}
+	}
+	if bytes.Equal(before[0], after[0]) {
+		t.Errorf("output repeated")
+	}
+}
+
+func TestJointRandomForfeit(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	var peer *Machine
+	ms := newGame(t, sra.P256, 3, nil, func(m *Machine) {
+		m.RevealTimeout = timeout
+		peer = m
+	})
+	// Delay the first revealed secret, sent after the commitments, until
+	// after the verdict.
+	var culpritKey ed25519.PublicKey
+	outs, errs := jointRandom(ms, "who starts", delay(len(ms)+1, 5*timeout, &culpritKey, &peer))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	culprit := ms[0].Player(culpritKey)
+	for i, m := range ms {
+		if !bytes.Equal(outs[i], outs[0]) {
+			t.Fatalf("player #%d: got %x, want %x", i+1, outs[i], outs[0])
+		}
+		forfeits := m.Forfeits()
+		if len(forfeits) != 1 || forfeits[0].Player != culprit || forfeits[0].Phase != `joint random #0 "who starts"` {
+			t.Fatalf("player #%d: got forfeits %+v, want player #%d", i+1, forfeits, culprit)
+		}
+		if err := forfeits[0].Verify(); err != nil {
+			t.Errorf("player #%d: %v", i+1, err)
+		}
+	}
+}
+
+func TestJointRandomInvalidMachine(t *testing.T) {
+	m := &Machine{}
+	if _, err := m.JointRandom(context.Background(), "who starts"); err == nil {
+		t.Error("got nil error, want error")
+	}
+}
+
+func TestRolls(t *testing.T) {
+	const nPlayers, sides = 4, 6
+	seen := make(map[int]int)
+	for i := 0; i < 200; i++ {
+		r := []byte{byte(i)}
+		rolls := Rolls(r, nPlayers, sides)
+		if again := Rolls(r, nPlayers, sides); !reflect.DeepEqual(rolls, again) {
+			t.Fatalf("Rolls is not deterministic: %v, then %v", rolls, again)
+		}
+		for _, roll := range rolls {
+			if roll < 1 || roll > sides {
+				t.Fatalf("roll %d out of range [1,%d]", roll, sides)
+			}
+			seen[roll]++
+		}
+	}
+	if len(seen) != sides {
+		t.Errorf("got rolls %v, want every side", seen)
+	}
+}
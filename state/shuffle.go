@@ -0,0 +1,250 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rhcarvalho/tiwe/crypto/commutative"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
+)
+
+// stateShuffleTiles lets each player, in gameplay order, encrypt every tile in
+// the pool with their initial key and shuffle the pool, proving that no tile
+// was duplicated or substituted. The first player starts from a new deck.
+func stateShuffleTiles(m *Machine) Fn {
+	player := m.order[m.turn]
+	in := m.pool
+	if m.turn == 0 {
+		in = m.codec.Deck()
+	}
+
+	if m.whoAmI == player {
+		key := m.deriveKey("initial", 0)
+		m.key = key
+		out, proof, err := key.Shuffle(m.ctx, m.Rand, in, m.ShuffleRounds)
+		if err != nil {
+			return m.Fail(err)
+		}
+		m.logf("Out <- pool of %d tiles", len(out))
+		if err := m.send(poolMessage{Pool: out, Proof: proof}); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	msg, err := m.recvPool(player)
+	if err != nil {
+		return m.Fail(err)
+	}
+	if err := sra.VerifyShuffle(m.ctx, m.Params, in, msg.Pool, msg.Proof, m.ShuffleRounds); err != nil {
+		if m.ctx.Err() != nil {
+			return m.Fail(err)
+		}
+		return m.Violation(player, fmt.Errorf("shuffle: %w", err))
+	}
+	m.pool = msg.Pool
+	m.shuffled = append(m.shuffled, msg.Pool)
+
+	m.turn++
+	if m.turn == len(m.order) {
+		m.turn = 0
+		return stateRekeyTiles
+	}
+	return stateShuffleTiles
+}
+
+// stateRekeyTiles lets each player, in gameplay order, decrypt every tile in
+// the pool with their initial key and encrypt it again with a tile-specific
+// key, proving for every tile that no tile was substituted.
+func stateRekeyTiles(m *Machine) Fn {
+	player := m.order[m.turn]
+
+	if m.whoAmI == player {
+		m.tileKeys = make([]provingKey, len(m.pool))
+		tileKeys := make([]*sra.Key, len(m.pool))
+		initial := make([]commutative.Key, len(m.pool))
+		keys := make([]commutative.Key, len(m.pool))
+		for i := range m.tileKeys {
+			tileKeys[i] = deriveKey(m.Params, m.Master, m.GameID, "tile", i)
+			m.tileKeys[i] = tileKeys[i]
+			initial[i], keys[i] = m.key, m.tileKeys[i]
+		}
+		pool, err := sra.DecryptEach(m.ctx, initial, m.pool)
+		if err != nil {
+			return m.Fail(err)
+		}
+		out, err := sra.EncryptEach(m.ctx, keys, pool)
+		if err != nil {
+			return m.Fail(err)
+		}
+		commitments := make([][]byte, len(m.tileKeys))
+		proofs := make([][]byte, len(m.tileKeys))
+		for i, key := range tileKeys {
+			if commitments[i], err = key.Commitment(); err != nil {
+				return m.Fail(err)
+			}
+			if proofs[i], err = m.key.ProveRekey(m.Rand, key, m.pool[i], out[i]); err != nil {
+				return m.Fail(err)
+			}
+		}
+		msg := poolMessage{Pool: out, Commitments: commitments, Proofs: proofs}
+		if msg.Key, err = m.key.Commitment(); err != nil {
+			return m.Fail(err)
+		}
+		if m.escrowEnabled() {
+			if msg.EscrowKey, err = m.escrowKey.Commitment(); err != nil {
+				return m.Fail(err)
+			}
+		}
+		m.logf("Out <- pool of %d tiles", len(out))
+		if err := m.send(msg); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	msg, err := m.recvPool(player)
+	if err != nil {
+		return m.Fail(err)
+	}
+	if err := m.checkCommitments(msg.Commitments); err != nil {
+		return m.Violation(player, err)
+	}
+	if err := m.checkRekey(msg); err != nil {
+		return m.Violation(player, err)
+	}
+	m.pool = msg.Pool
+	m.commitments[player-1] = msg.Commitments
+	m.initialKeys[player-1] = msg.Key
+	m.rekeyed = append(m.rekeyed, msg.Pool)
+	if m.escrowEnabled() {
+		if err := m.Params.CheckCiphertext(msg.EscrowKey); err != nil {
+			return m.Violation(player, fmt.Errorf("escrow key: %w", err))
+		}
+		m.escrowKeys[player-1] = msg.EscrowKey
+	}
+
+	m.turn++
+	if m.turn == len(m.order) {
+		m.turn = 0
+		// Hands are dealt from the top of the pool.
+		m.drawn = len(m.order) * handSize
+		m.logf("pool ready with %d tiles", len(m.pool))
+		if m.escrowEnabled() {
+			return stateEscrowKeys
+		}
+		return m.startDeal()
+	}
+	return stateRekeyTiles
+}
+
+// A provingKey is a commutative.Key that also proves to other players what it
+// did, as implemented by sra.Key. The machine only needs the methods of
+// commutative.Key to encrypt and decrypt, and these to publish proofs.
+type provingKey interface {
+	commutative.Key
+	Commitment() ([]byte, error)
+	ProveDecryption(random io.Reader, ciphertext, plaintext []byte) ([]byte, error)
+	ProveRekey(random io.Reader, to *sra.Key, ciphertext, rekeyed []byte) ([]byte, error)
+	ShareDecryption(random io.Reader, threshold int, indices []int) (*sra.Sharing, [][]byte, error)
+	Shuffle(ctx context.Context, random io.Reader, in [][]byte, rounds int) (out [][]byte, proof []byte, err error)
+}
+
+// deriveKey derives a key from the master secret of this player.
+func (m *Machine) deriveKey(label string, index int) provingKey {
+	return deriveKey(m.Params, m.Master, m.GameID, label, index)
+}
+
+// deriveKey derives a key from master, see sra.DeriveKeyWithParams.
+func deriveKey(params *sra.Params, master []byte, gameID, label string, index int) *sra.Key {
+	return sra.DeriveKeyWithParams(params, master, gameID, label, index)
+}
+
+// A poolMessage is the payload of messages in the shuffle phase.
+type poolMessage struct {
+	Pool [][]byte
+	// Proof that Pool is a shuffle of the previous pool, only sent in the
+	// shuffle phase.
+	Proof []byte
+	// Commitments to the tile-specific keys of the sender, one per tile,
+	// only sent in the rekey phase.
+	Commitments [][]byte
+	// Key is a commitment to the initial key of the sender, and Proofs
+	// prove that each tile in Pool is the tile in the same position of the
+	// previous pool, decrypted with the initial key and encrypted with the
+	// tile-specific key, see sra.Key.ProveRekey. Only sent in the rekey
+	// phase.
+	Key    []byte
+	Proofs [][]byte
+	// EscrowKey is a commitment to the key used to encrypt escrowed
+	// shares to the sender, only sent in the rekey phase if keys are
+	// escrowed.
+	EscrowKey []byte
+}
+
+// recvPool receives a pool of encrypted tiles from player, and checks that the
+// received pool is valid. The caller replaces the current pool once it checks
+// that the received pool derives from it.
+func (m *Machine) recvPool(player int) (*poolMessage, error) {
+	var msg poolMessage
+	if err := m.recv(player, &msg); err != nil {
+		return nil, err
+	}
+	m.logf("In -> pool of %d tiles", len(msg.Pool))
+	if err := m.checkPool(msg.Pool); err != nil {
+		return nil, m.protocolError(player, err)
+	}
+	return &msg, nil
+}
+
+// checkCommitments checks that there is one valid commitment per tile.
+func (m *Machine) checkCommitments(commitments [][]byte) error {
+	if len(commitments) != game.NumTiles {
+		return fmt.Errorf("got %d key commitments, want %d", len(commitments), game.NumTiles)
+	}
+	for i, c := range commitments {
+		if err := m.Params.CheckCiphertext(c); err != nil {
+			return fmt.Errorf("key commitment %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkRekey checks that msg proves, for every tile, that the rekeyed pool
+// derives from the current pool.
+func (m *Machine) checkRekey(msg *poolMessage) error {
+	if err := m.Params.CheckCiphertext(msg.Key); err != nil {
+		return fmt.Errorf("initial key: %w", err)
+	}
+	if len(msg.Proofs) != len(msg.Pool) {
+		return fmt.Errorf("rekeyed %d tiles with %d proofs", len(msg.Pool), len(msg.Proofs))
+	}
+	for i, proof := range msg.Proofs {
+		if err := sra.VerifyRekey(m.Params, msg.Key, msg.Commitments[i], m.pool[i], msg.Pool[i], proof); err != nil {
+			return fmt.Errorf("rekey: tile %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkPool checks that pool has the expected number of distinct valid
+// ciphertexts.
+func (m *Machine) checkPool(pool [][]byte) error {
+	if len(pool) != game.NumTiles {
+		return fmt.Errorf("pool has %d tiles, want %d", len(pool), game.NumTiles)
+	}
+	seen := make(map[string]struct{}, len(pool))
+	for i, c := range pool {
+		if err := m.Params.CheckCiphertext(c); err != nil {
+			return fmt.Errorf("tile %d: %w", i, err)
+		}
+		if err := m.codec.Check(c); err != nil {
+			return fmt.Errorf("tile %d: %w", i, err)
+		}
+		if _, ok := seen[string(c)]; ok {
+			return fmt.Errorf("tile %d: duplicate ciphertext", i)
+		}
+		seen[string(c)] = struct{}{}
+	}
+	return nil
+}
@@ -2,21 +2,42 @@
 package state
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
 	"fmt"
+	"io"
 	"log"
 	"sort"
+	"time"
 
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/identity"
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/crypto/timelock"
+	"github.com/rhcarvalho/tiwe/game"
+	"github.com/rhcarvalho/tiwe/game/tilecode"
 	"golang.org/x/crypto/blake2b"
 )
 
 // MinPlayers is the minimum number of players in a game.
 const MinPlayers = 2
 
-// A Message carries the input data that causes state transitions.
+// A Message carries the input data that causes state transitions. Messages are
+// signed by their sender, see package github.com/rhcarvalho/tiwe/crypto/identity.
 type Message struct {
-	From int
+	// From is the identity of the sender, one of Machine.Players.
+	From ed25519.PublicKey
+	// Seq is the sequence number of the message among those sent by From
+	// in the game, starting at zero.
+	Seq  uint64
 	Data []byte
+	// Signature is the signature of the game ID, Seq and Data by From.
+	Signature []byte
 }
 
 // A Fn represents a state. Calling Fn transitions into the next state.
@@ -24,17 +45,137 @@ type Fn func(m *Machine) Fn
 
 // Machine represents the game state machine.
 type Machine struct {
-	NPlayers int
-	WhoAmI   int
+	// Players are the identities of all players, in the implicit order.
+	// Players are numbered from 1 to len(Players) in this order.
+	Players []ed25519.PublicKey
+	// Identity is the signing key of this player, whose public key must
+	// be in Players. It signs every message sent, and evidence of
+	// forfeits.
+	Identity ed25519.PrivateKey
 	In       <-chan Message
 	Out      chan<- Message
+	// Params are the SRA group parameters used to encrypt tiles. All
+	// players must use the same parameters. Players prove every shuffle
+	// and decryption, so the parameters must be in subgroup mode with a
+	// generator, see sra.Params.HasGenerator. If nil, sra.MODP2048Q256 is
+	// used in subgroup mode, since its short exponents keep shuffle proofs
+	// affordable. sra.P256 is faster and its messages are much smaller.
+	Params *sra.Params
+	// ShuffleRounds is the number of rounds of the proofs that each player
+	// shuffled the pool correctly, see sra.Key.Shuffle. Proofs with fewer
+	// rounds are rejected, so all players should use the same value. If
+	// zero, sra.DefaultShuffleRounds is used.
+	ShuffleRounds int
+	// Rules are the rules of the game, checked in every move. All players
+	// must use the same rules, which Run checks with the parameters before
+	// the game starts. If nil, game.DefaultRules is used.
+	Rules *game.Rules
+	// GameID identifies the game, and must be unique. Signatures and
+	// commitments are bound to it, such that they are not valid in another
+	// game. It must not be empty.
+	GameID string
+	// Master is the secret from which all SRA keys of this player are
+	// derived, see sra.DeriveKey. If nil, a random master secret is
+	// generated. Storing the master secret is enough to recover all keys.
+	Master []byte
+	// Rand is the source of randomness of this player, used to generate
+	// the master secret, the gameplay order secret, shuffles and proofs.
+	// Errors reading from Rand fail the game. If nil, crypto/rand.Reader is
+	// used through a buffer. Deterministic sources, see NewDeterministic in
+	// package github.com/rhcarvalho/tiwe/crypto/rand, allow replaying a
+	// game exactly in tests and simulations.
+	Rand io.Reader
+	// EscrowThreshold is the number of remaining players needed to recover
+	// the pool when a player leaves the game, see RecoverPool. If positive,
+	// each player shares their tile keys among the other players after the
+	// shuffle, and it must be less than NPlayers. Only the keys of tiles
+	// left in the pool after the deal are shared, such that hands stay
+	// concealed. Since any EscrowThreshold players can jointly decrypt the
+	// pool, a threshold of 1 lets a single opponent see the pool. If zero,
+	// keys are not escrowed. All players must use the same threshold.
+	EscrowThreshold int
+	// RevealTimeout is how long the next player in the implicit order
+	// waits for each player to reveal their secret for the gameplay order,
+	// and in JointRandom. A player who does not reveal the secret for the
+	// gameplay order in time forfeits: they are placed last in the
+	// gameplay order, and Forfeits returns signed evidence. If zero,
+	// players wait forever, and the last player to reveal can learn the
+	// order before deciding to leave the game. All players must use the
+	// same timeout, such that they agree on who forfeits.
+	RevealTimeout time.Duration
+	// TimeLock is the number of sequential squarings of the time-lock
+	// puzzle of each player's secret for the gameplay order, see package
+	// github.com/rhcarvalho/tiwe/crypto/timelock. If positive, the secret
+	// of a player who forfeits is recovered from the puzzle, such that
+	// withholding it does not change the order of the other players. A
+	// puzzle that does not unlock to the secret counts as no time lock,
+	// and is kept as evidence in Forfeits. All players must use the same
+	// value.
+	TimeLock uint64
 
+	ctx        context.Context
+	ready      bool // whether setup initialized the machine
+	nPlayers   int
+	whoAmI     int // number of this player
 	nextPlayer int // players are numbered 1..N
 	err        error
+	seq        uint64   // sequence number of the next message sent
+	seqs       []uint64 // sequence number of the next message, per player
 
-	ss    [][8]byte
-	hs    [][32]byte
-	order []int
+	opening commit.Opening // own secret for the gameplay order
+	ss      [][8]byte
+	hs      []commit.Commitment
+	order   []int
+
+	puzzles  []*timelock.Puzzle // time-locked secrets, per player
+	forfeits []Forfeit
+	late     map[int]int // number of late messages to skip, per player
+
+	keysOpening    commit.Opening      // own master secret
+	keyCommitments []commit.Commitment // commitments to master secrets, per player
+
+	turn     int          // index into order of the player acting next
+	key      provingKey   // initial key used to shuffle the pool
+	tileKeys []provingKey // tile-specific keys, one per position in the pool
+	pool     [][]byte
+	codec    *tilecode.Codec
+
+	commitments   [][][]byte // commitments to tile keys, per player
+	initialKeys   [][]byte   // commitments to initial keys, per player
+	partial       [][]byte   // partially decrypted tiles being dealt
+	hand          []game.Tile
+	handPositions []int // positions in the pool of the tiles in hand
+	drawn         int   // number of tiles drawn from the pool
+
+	board  game.Board   // tiles on the table
+	opened map[int]bool // positions in the pool of tiles played
+	melded map[int]bool // players who made their initial meld
+	mover  int          // index into order of the player moving next
+	move   *moveMessage // own move being played
+	passed map[int]bool // players who passed since the last move playing tiles
+
+	drawers []int // players who drew the tiles after the dealt ones, in order
+
+	// Transcript of published tiles, per turn in gameplay order, re-run
+	// in the audit.
+	shuffled [][][]byte // pools published in the shuffle phase
+	rekeyed  [][][]byte // pools published in the rekey phase
+	revealed [][][]byte // values revealed in the deal phase
+
+	masters [][]byte // master secrets revealed in the audit, per player
+	report  *AuditReport
+
+	joint       *jointRound // current run of JointRandom
+	jointRounds int         // number of runs of JointRandom
+
+	escrowKey  provingKey      // key to exchange shares with other players
+	escrowKeys [][]byte        // commitments to escrow keys, per player
+	sharings   [][]sra.Sharing // public sharings of tile keys, per player
+	shares     [][][]byte      // own shares of tile keys, per player
+	departed   map[int]bool    // players who left the game
+	recovering int             // player whose keys are being recovered
+	quorum     []int           // players revealing partial decryptions
+	recovered  [][][]byte      // partial decryptions per position in the pool
 
 	debug bool
 }
@@ -42,11 +183,47 @@ type Machine struct {
 // Run runs the state machine until it terminates, returning a non-nil error if
 // execution failed.
 func (m *Machine) Run() error {
-	if m.NPlayers < MinPlayers {
-		return fmt.Errorf("too few players: got %d, want %d or more", m.NPlayers, MinPlayers)
+	return m.RunContext(context.Background())
+}
+
+// RunContext is like Run, but long running computations are abandoned if ctx
+// is canceled.
+func (m *Machine) RunContext(ctx context.Context) error {
+	if err := m.setup(); err != nil {
+		return err
 	}
-	if m.WhoAmI < 1 || m.WhoAmI > m.NPlayers {
-		return fmt.Errorf("invalid player identification: %d not in range [1,%d]", m.WhoAmI, m.NPlayers)
+	m.ctx = ctx
+	for state := stateSetupParams; state != nil; {
+		state = state(m)
+	}
+	return m.Err()
+}
+
+// setup checks the configuration of m and initializes its state, unless it is
+// already initialized by a previous call.
+func (m *Machine) setup() error {
+	if m.ready {
+		return nil
+	}
+	m.nPlayers = len(m.Players)
+	if m.nPlayers < MinPlayers {
+		return fmt.Errorf("too few players: got %d, want %d or more", m.nPlayers, MinPlayers)
+	}
+	if m.GameID == "" {
+		return fmt.Errorf("missing game ID")
+	}
+	if len(m.Identity) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid identity: got %d bytes, want %d", len(m.Identity), ed25519.PrivateKeySize)
+	}
+	seen := make(map[string]bool)
+	for i, pub := range m.Players {
+		if seen[string(pub)] {
+			return fmt.Errorf("duplicate identity of player #%d", i+1)
+		}
+		seen[string(pub)] = true
+	}
+	if m.whoAmI = m.Player(m.Identity.Public().(ed25519.PublicKey)); m.whoAmI == 0 {
+		return fmt.Errorf("invalid player identification: identity not among players")
 	}
 	if m.In == nil {
 		return fmt.Errorf("m.In is nil")
@@ -54,12 +231,69 @@ func (m *Machine) Run() error {
 	if m.Out == nil {
 		return fmt.Errorf("m.Out is nil")
 	}
-	for state := stateGameplayOrder1PublishH; state != nil; {
-		state = state(m)
+	if m.EscrowThreshold < 0 || m.EscrowThreshold >= m.nPlayers {
+		return fmt.Errorf("invalid escrow threshold: %d not in range [0,%d]", m.EscrowThreshold, m.nPlayers-1)
 	}
-	return m.Err()
+	if m.RevealTimeout < 0 {
+		return fmt.Errorf("invalid reveal timeout: %v", m.RevealTimeout)
+	}
+	if m.Params == nil {
+		m.Params = sra.MODP2048Q256.RestrictToSubgroup()
+	}
+	if !m.Params.HasGenerator() {
+		return fmt.Errorf("parameters %s: %w", m.Params.Name, sra.ErrNoGenerator)
+	}
+	if m.ShuffleRounds == 0 {
+		m.ShuffleRounds = sra.DefaultShuffleRounds
+	}
+	if m.Rules == nil {
+		rules := game.DefaultRules
+		m.Rules = &rules
+	}
+	if m.Rand == nil {
+		m.Rand = tiwerand.NewSource(rand.Reader)
+	}
+	if m.Master == nil {
+		m.Master = make([]byte, sra.MasterSize)
+		if _, err := io.ReadFull(m.Rand, m.Master); err != nil {
+			return err
+		}
+	}
+	if m.TimeLock > 0 {
+		m.puzzles = make([]*timelock.Puzzle, m.nPlayers)
+	}
+	m.late = make(map[int]int)
+	m.seqs = make([]uint64, m.nPlayers)
+	m.codec = tilecode.New(m.Params)
+	m.commitments = make([][][]byte, m.nPlayers)
+	m.initialKeys = make([][]byte, m.nPlayers)
+	m.keyCommitments = make([]commit.Commitment, m.nPlayers)
+	if m.escrowEnabled() {
+		m.escrowKey = m.deriveKey("escrow", 0)
+		m.escrowKeys = make([][]byte, m.nPlayers)
+		m.sharings = make([][]sra.Sharing, m.nPlayers)
+		m.shares = make([][][]byte, m.nPlayers)
+		m.departed = make(map[int]bool)
+	}
+	m.ready = true
+	return nil
 }
 
+// A ProtocolError reports a message from another player that violates the
+// game protocol.
+type ProtocolError struct {
+	Player    int
+	PublicKey ed25519.PublicKey // identity of Player
+	Err       error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("player #%d violated the protocol: %v", e.Player, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ProtocolError) Unwrap() error { return e.Err }
+
 // Err returns the error associated with this machine. A non-nil error means the
 // machine terminated in a failure state.
 func (m *Machine) Err() error {
@@ -73,43 +307,215 @@ func (m *Machine) Fail(err error) Fn {
 	return nil
 }
 
+// Player returns the number of the player with the given identity, or zero if
+// there is none.
+func (m *Machine) Player(pub ed25519.PublicKey) int {
+	for i, p := range m.Players {
+		if bytes.Equal(p, pub) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// send broadcasts v, encoded with encoding/gob.
+func (m *Machine) send(v interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	m.sendData(buf.Bytes())
+	return nil
+}
+
+// sendData broadcasts data in a signed message.
+func (m *Machine) sendData(data []byte) {
+	m.Out <- Message{
+		From:      m.Identity.Public().(ed25519.PublicKey),
+		Seq:       m.seq,
+		Data:      data,
+		Signature: identity.Sign(m.Identity, m.GameID, m.seq, data),
+	}
+	m.seq++
+}
+
+// recv receives the next message, which must come from player, and decodes it
+// into v. Messages that cannot be decoded are protocol violations.
+func (m *Machine) recv(player int, v interface{}) error {
+	from, data, err := m.next()
+	if err != nil {
+		return err
+	}
+	if from != player {
+		return fmt.Errorf("message from unexpected player: got %v, want %v", from, player)
+	}
+	return m.decode(from, data, v)
+}
+
+// next receives the next message, skipping late messages, and returns the
+// number of its sender and its data.
+func (m *Machine) next() (int, []byte, error) {
+	for {
+		msg, ok := <-m.In
+		if !ok {
+			return 0, nil, fmt.Errorf("expected more messages")
+		}
+		player, err := m.accept(msg)
+		if err != nil {
+			return 0, nil, err
+		}
+		if player != 0 {
+			return player, msg.Data, nil
+		}
+	}
+}
+
+// accept verifies the sender, signature and sequence number of msg, and
+// returns the number of its sender, or zero if msg is a late message to be
+// discarded, see recvOpening. Messages that cannot be attributed to a player,
+// or that are out of sequence, fail the game.
+func (m *Machine) accept(msg Message) (int, error) {
+	player := m.Player(msg.From)
+	if player == 0 {
+		return 0, fmt.Errorf("message from unknown player %s", identity.Encode(msg.From))
+	}
+	if err := identity.Verify(msg.From, m.GameID, msg.Seq, msg.Data, msg.Signature); err != nil {
+		return 0, fmt.Errorf("message from player #%d: %w", player, err)
+	}
+	if want := m.seqs[player-1]; msg.Seq != want {
+		return 0, fmt.Errorf("message from player #%d out of sequence: got %d, want %d", player, msg.Seq, want)
+	}
+	m.seqs[player-1]++
+	if m.late[player] > 0 {
+		m.late[player]--
+		return 0, nil
+	}
+	return player, nil
+}
+
+// decode decodes data sent by player into v. Messages that cannot be decoded
+// are protocol violations.
+func (m *Machine) decode(player int, data []byte, v interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return m.protocolError(player, fmt.Errorf("cannot decode message: %w", err))
+	}
+	return nil
+}
+
+// protocolError returns a ProtocolError blaming player.
+func (m *Machine) protocolError(player int, err error) *ProtocolError {
+	return &ProtocolError{Player: player, PublicKey: m.Players[player-1], Err: err}
+}
+
+// Violation fails the machine with a ProtocolError blaming player.
+func (m *Machine) Violation(player int, err error) Fn {
+	return m.Fail(m.protocolError(player, err))
+}
+
 func (m *Machine) logf(format string, args ...interface{}) {
 	if m.debug {
-		log.Printf("Player #%d: %s", m.WhoAmI, fmt.Sprintf(format, args...))
+		log.Printf("Player #%d: %s", m.whoAmI, fmt.Sprintf(format, args...))
 	}
 }
 
+// stateSetupParams checks that all players use the same SRA group parameters
+// and rules, see setupDigest.
+func stateSetupParams(m *Machine) Fn {
+	m.nextPlayer = m.nextPlayer%m.nPlayers + 1
+
+	digest := m.setupDigest()
+	if m.whoAmI == m.nextPlayer {
+		m.logf("Out <- %x", digest)
+		m.sendData(digest)
+	}
+
+	from, data, err := m.next()
+	if err != nil {
+		return m.Fail(err)
+	}
+	if from != m.nextPlayer {
+		return m.Fail(fmt.Errorf("message from unexpected player: got %v, want %v", from, m.nextPlayer))
+	}
+	m.logf("In -> %x", data)
+	if !bytes.Equal(data, digest) {
+		return m.Violation(from, fmt.Errorf("different parameters or rules: got %x, want %x (parameters %s, %+v, escrow threshold %d, reveal timeout %v, time lock %d)",
+			data, digest, m.Params.Name, *m.Rules, m.EscrowThreshold, m.RevealTimeout, m.TimeLock))
+	}
+
+	if m.nextPlayer == m.nPlayers {
+		return stateGameplayOrder1PublishH
+	}
+
+	return stateSetupParams
+}
+
+// setupDigest returns the BLAKE2b-256 digest of the configuration that all
+// players must share: the ID of the SRA group parameters, the rules, the
+// escrow threshold, the reveal timeout and the time lock. Fields added to
+// game.Rules must be added to the digest.
+func (m *Machine) setupDigest() []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte("tiwe/state setup\x00"))
+	id := m.Params.ID()
+	h.Write(id[:])
+	var b [32]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(m.Rules.InitialMeld))
+	binary.BigEndian.PutUint64(b[8:16], uint64(m.EscrowThreshold))
+	binary.BigEndian.PutUint64(b[16:24], uint64(m.RevealTimeout))
+	binary.BigEndian.PutUint64(b[24:], m.TimeLock)
+	h.Write(b[:])
+	return h.Sum(nil)
+}
+
+// stateGameplayOrder1PublishH publishes commitments to a random secret per
+// player, such that no player can choose a secret after seeing the others.
 func stateGameplayOrder1PublishH(m *Machine) Fn {
-	m.nextPlayer = m.nextPlayer%m.NPlayers + 1
+	m.nextPlayer = m.nextPlayer%m.nPlayers + 1
 
-	if m.WhoAmI == m.nextPlayer {
+	if m.whoAmI == m.nextPlayer {
 		var s [8]byte
-		if _, err := rand.Read(s[:]); err != nil {
+		if _, err := io.ReadFull(m.Rand, s[:]); err != nil {
+			return m.Fail(err)
+		}
+		c, o, err := commit.Commit(m.Rand, m.orderDomain(m.whoAmI), s[:])
+		if err != nil {
+			return m.Fail(err)
+		}
+		m.opening = o
+		m.hs = append(m.hs, c)
+		m.logf("Out <- %x", c)
+		if err := m.send(c); err != nil {
 			return m.Fail(err)
 		}
-		h := blake2b.Sum256(s[:])
-		m.ss = append(m.ss, s)
-		m.hs = append(m.hs, h)
-		m.logf("Out <- %x", h)
-		m.Out <- Message{
-			From: m.WhoAmI,
-			Data: h[:],
+		if m.TimeLock > 0 {
+			puzzle, err := m.lockSecret(o)
+			if err != nil {
+				return m.Fail(err)
+			}
+			if err := m.send(puzzle); err != nil {
+				return m.Fail(err)
+			}
 		}
 	}
 
-	msg, ok := <-m.In
-	if !ok {
-		return m.Fail(fmt.Errorf("expected more messages"))
+	var got commit.Commitment
+	if err := m.recv(m.nextPlayer, &got); err != nil {
+		return m.Fail(err)
 	}
-	if msg.From != m.nextPlayer {
-		return m.Fail(fmt.Errorf("message from unexpected player: got %v, want %v", msg.From, m.nextPlayer))
+	m.logf("In -> %x", got)
+	if m.TimeLock > 0 {
+		var puzzle timelock.Puzzle
+		if err := m.recv(m.nextPlayer, &puzzle); err != nil {
+			return m.Fail(err)
+		}
+		if puzzle.T != m.TimeLock {
+			return m.Violation(m.nextPlayer, fmt.Errorf("time lock of %d squarings, want %d", puzzle.T, m.TimeLock))
+		}
+		m.puzzles[m.nextPlayer-1] = &puzzle
 	}
-	m.logf("In -> %x", msg.Data)
-	var got [blake2b.Size256]byte
-	copy(got[:], msg.Data)
 
-	if msg.From == m.WhoAmI {
-		want := m.hs[m.WhoAmI-1]
+	if m.nextPlayer == m.whoAmI {
+		want := m.hs[m.whoAmI-1]
 		if want != got {
 			return m.Fail(fmt.Errorf("corrupted message: want %x, got %x", want, got))
 		}
@@ -117,66 +523,160 @@ func stateGameplayOrder1PublishH(m *Machine) Fn {
 		m.hs = append(m.hs, got)
 	}
 
-	if len(m.hs) == m.NPlayers {
+	if len(m.hs) == m.nPlayers {
 		return stateGameplayOrder2PublishS
 	}
 
 	return stateGameplayOrder1PublishH
 }
 
+// stateGameplayOrder2PublishS reveals the secrets committed to in
+// stateGameplayOrder1PublishH.
 func stateGameplayOrder2PublishS(m *Machine) Fn {
-	m.nextPlayer = m.nextPlayer%m.NPlayers + 1
+	m.nextPlayer = m.nextPlayer%m.nPlayers + 1
+	player := m.nextPlayer
 
-	if m.WhoAmI == m.nextPlayer {
-		s := m.ss[m.WhoAmI-1]
-		m.logf("Out <- %x", s)
-		m.Out <- Message{
-			From: m.WhoAmI,
-			Data: s[:],
+	if m.whoAmI == player {
+		m.logf("Out <- %x", m.opening.Value)
+		if err := m.send(m.opening); err != nil {
+			return m.Fail(err)
 		}
 	}
 
-	msg, ok := <-m.In
-	if !ok {
-		return m.Fail(fmt.Errorf("expected more messages"))
+	o := new(commit.Opening)
+	if m.RevealTimeout > 0 {
+		var f *Forfeit
+		var err error
+		if o, f, err = m.recvOpening(m.orderDomain(player), m.hs[player-1], m.judge(player)); err != nil {
+			return m.Fail(err)
+		}
+		if f != nil {
+			m.forfeits = append(m.forfeits, *f)
+		}
+	} else if err := m.recv(player, o); err != nil {
+		return m.Fail(err)
+	}
+	forfeited := o == nil
+	if forfeited && m.TimeLock > 0 {
+		var err error
+		if o, err = m.unlockSecret(player); err != nil {
+			if m.ctx.Err() != nil {
+				return m.Fail(err)
+			}
+			// Aborting would let the player withhold their
+			// secret after learning the order. Keep the puzzle
+			// as evidence instead.
+			m.logf("player #%d: time-locked secret: %v", player, err)
+			m.forfeits[len(m.forfeits)-1].Puzzle = m.puzzles[player-1]
+		}
 	}
-	if msg.From != m.nextPlayer {
-		return m.Fail(fmt.Errorf("message from unexpected player: got %v, want %v", msg.From, m.nextPlayer))
+	if o == nil {
+		// The order is derived from the secrets of the other players.
+		m.ss = append(m.ss, [8]byte{})
+		return m.nextReveal()
 	}
-	m.logf("In -> %x", msg.Data)
-	var got [8]byte
-	copy(got[:], msg.Data)
+	m.logf("In -> %x", o.Value)
 
-	if msg.From == m.WhoAmI {
-		want := m.ss[m.WhoAmI-1]
-		if want != got {
-			return m.Fail(fmt.Errorf("corrupted message: want %x, got %x", want, got))
+	switch {
+	case forfeited:
+		// Checked by unlockSecret.
+	case player == m.whoAmI:
+		if want := m.opening; !bytes.Equal(o.Value, want.Value) || o.Salt != want.Salt {
+			return m.Fail(fmt.Errorf("corrupted message: want %x, got %x", want.Value, o.Value))
 		}
-	} else {
-		if got, want := blake2b.Sum256(msg.Data), m.hs[msg.From-1]; got != want {
-			return m.Fail(fmt.Errorf("hash of %x does not match: got %x, want %x", msg.Data, got, want))
+	default:
+		if err := commit.Verify(m.orderDomain(player), m.hs[player-1], *o); err != nil {
+			return m.Violation(player, fmt.Errorf("secret %x: %w", o.Value, err))
+		}
+		if len(o.Value) != 8 {
+			return m.Violation(player, fmt.Errorf("invalid secret size: got %d, want 8", len(o.Value)))
 		}
-		m.ss = append(m.ss, got)
 	}
+	var s [8]byte
+	copy(s[:], o.Value)
+	m.ss = append(m.ss, s)
+	return m.nextReveal()
+}
 
-	if len(m.ss) == m.NPlayers {
+// nextReveal returns the next state after a secret for the gameplay order is
+// revealed.
+func (m *Machine) nextReveal() Fn {
+	if len(m.ss) == m.nPlayers {
 		return stateGameplayOrder3Compute
 	}
-
 	return stateGameplayOrder2PublishS
 }
 
+// orderDomain returns the domain of the commitment of player to its secret for
+// the gameplay order.
+func (m *Machine) orderDomain(player int) commit.Domain {
+	return commit.Domain{GameID: m.GameID, Phase: orderPhase, Player: player}
+}
+
+// orderPhase is the phase of commitments to secrets for the gameplay order.
+const orderPhase = "gameplay order"
+
 func stateGameplayOrder3Compute(m *Machine) Fn {
 	t := blake2b.Sum256(xor(m.ss...))
 	m.order = m.order[:0]
-	for i := 1; i <= m.NPlayers; i++ {
+	for i := 1; i <= m.nPlayers; i++ {
 		m.order = append(m.order, i)
 	}
 	sort.SliceStable(m.order, func(i int, j int) bool {
 		return string(t[i*8:i*8+8]) < string(t[j*8:j*8+8])
 	})
+	// Players who forfeited go last.
+	forfeited := make(map[int]bool)
+	for _, f := range m.forfeits {
+		if f.Phase == orderPhase {
+			forfeited[f.Player] = true
+		}
+	}
+	sort.SliceStable(m.order, func(i, j int) bool {
+		return !forfeited[m.order[i]] && forfeited[m.order[j]]
+	})
 	m.logf("gameplay order: %v", m.order)
-	return stateShuffleTiles
+	m.turn = 0
+	return stateCommitKeys
+}
+
+// stateCommitKeys lets each player, in gameplay order, commit to their master
+// secret, and thus to all keys derived from it, before using any key. The
+// commitments are opened in the audit at the end of the game, see Audit.
+func stateCommitKeys(m *Machine) Fn {
+	player := m.order[m.turn]
+
+	if m.whoAmI == player {
+		c, o, err := commit.Commit(m.Rand, m.keysDomain(m.whoAmI), m.Master)
+		if err != nil {
+			return m.Fail(err)
+		}
+		m.keysOpening = o
+		m.logf("Out <- %x", c)
+		if err := m.send(c); err != nil {
+			return m.Fail(err)
+		}
+	}
+
+	var c commit.Commitment
+	if err := m.recv(player, &c); err != nil {
+		return m.Fail(err)
+	}
+	m.logf("In -> %x", c)
+	m.keyCommitments[player-1] = c
+
+	m.turn++
+	if m.turn == len(m.order) {
+		m.turn = 0
+		return stateShuffleTiles
+	}
+	return stateCommitKeys
+}
+
+// keysDomain returns the domain of the commitment of player to its master
+// secret.
+func (m *Machine) keysDomain(player int) commit.Domain {
+	return commit.Domain{GameID: m.GameID, Phase: "keys", Player: player}
 }
 
 // xor returns the exclusive or of 8-byte arrays as an 8-byte slice.
@@ -194,7 +694,3 @@ func xor(ss ...[8]byte) []byte {
 	}
 	return out
 }
-
-func stateShuffleTiles(m *Machine) Fn {
-	return m.Fail(fmt.Errorf("state not implemented yet: waiting for Player #%d to shuffle tiles", m.order[0]))
-}
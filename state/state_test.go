@@ -1,52 +1,827 @@
 package state
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
-	"golang.org/x/crypto/blake2b"
+	"github.com/rhcarvalho/tiwe/crypto/commit"
+	"github.com/rhcarvalho/tiwe/crypto/identity"
+	tiwerand "github.com/rhcarvalho/tiwe/crypto/rand"
+	"github.com/rhcarvalho/tiwe/crypto/sra"
+	"github.com/rhcarvalho/tiwe/game"
 )
 
+var seedFlag = flag.String("seed", "", "hex-encoded `seed` of the players' randomness, to replay games logged by a failing test")
+
 func TestStateMachine(t *testing.T) {
-	in := make(chan Message, 1)
-	out := make(chan Message, 1)
-	m := Machine{
-		NPlayers: 3,
-		WhoAmI:   1,
-		In:       in,
-		Out:      out,
+	for _, params := range []*sra.Params{sra.MODP1024.RestrictToSubgroup(), sra.P256} {
+		t.Run(params.Name, func(t *testing.T) {
+			testStateMachine(t, params)
+		})
+	}
+}
+
+func testStateMachine(t *testing.T, params *sra.Params) {
+	const nPlayers = 3
+	ms, errs := runGame(t, params, nPlayers, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("player #%d: %v", i+1, err)
+		}
+	}
+	pool := ms[0].pool
+	for _, m := range ms[1:] {
+		if !reflect.DeepEqual(m.pool, pool) {
+			t.Fatalf("player #%d has a different pool", m.whoAmI)
+		}
+	}
+	// Opening every tile with all tile-specific keys, in any order, must
+	// yield the original deck.
+	seen := make(map[game.Tile]int)
+	for i, c := range pool {
+		for j := len(ms) - 1; j >= 0; j-- {
+			var err error
+			c, err = ms[j].tileKeys[i].Decrypt(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tile, err := ms[0].codec.DecodeTile(c)
+		if err != nil {
+			t.Fatalf("tile %d: %v", i, err)
+		}
+		seen[tile]++
+	}
+	for tile, n := range seen {
+		if n != 2 {
+			t.Errorf("tile %v seen %d times, want 2", tile, n)
+		}
+	}
+	// Every player has a hand of distinct tiles from the pool.
+	dealt := make(map[game.Tile]int)
+	for _, m := range ms {
+		if len(m.hand) != handSize {
+			t.Errorf("player #%d: got %d tiles, want %d", m.whoAmI, len(m.hand), handSize)
+		}
+		for _, tile := range m.hand {
+			dealt[tile]++
+		}
+	}
+	for tile, n := range dealt {
+		if n > seen[tile] {
+			t.Errorf("tile %v dealt %d times, want at most %d", tile, n, seen[tile])
+		}
+	}
+	// All keys can be recovered from the master secret.
+	for _, m := range ms {
+		for i, key := range m.tileKeys {
+			recovered := sra.DeriveKeyWithParams(m.Params, m.Master, m.GameID, "tile", i)
+			if recovered.Fingerprint() != key.Fingerprint() {
+				t.Fatalf("player #%d: cannot recover key of tile %d", m.whoAmI, i)
+			}
+		}
+	}
+}
+
+func TestStateMachineInvalidPool(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(pool [][]byte) [][]byte
+		want   string
+	}{
+		{
+			name: "invalid ciphertext",
+			tamper: func(pool [][]byte) [][]byte {
+				pool[0] = []byte{0}
+				return pool
+			},
+			want: sra.ErrInvalidCiphertext.Error(),
+		},
+		{
+			name: "duplicate ciphertext",
+			tamper: func(pool [][]byte) [][]byte {
+				pool[1] = pool[0]
+				return pool
+			},
+			want: "duplicate ciphertext",
+		},
+		{
+			name: "quadratic nonresidue",
+			tamper: func(pool [][]byte) [][]byte {
+				x := big.NewInt(2)
+				for big.Jacobi(x, sra.MODP1024.N) != -1 {
+					x.Add(x, big.NewInt(1))
+				}
+				pool[0] = x.Bytes()
+				return pool
+			},
+			want: sra.ErrNotInSubgroup.Error(),
+		},
+		{
+			name: "element of order 2",
+			tamper: func(pool [][]byte) [][]byte {
+				pool[0] = new(big.Int).Sub(sra.MODP1024.N, big.NewInt(1)).Bytes()
+				return pool
+			},
+			want: sra.ErrNotInSubgroup.Error(),
+		},
+		{
+			name: "substituted tile",
+			tamper: func(pool [][]byte) [][]byte {
+				// The square of a ciphertext encrypts the square
+				// of a tile, which is not another tile.
+				x := new(big.Int).SetBytes(pool[0])
+				pool[0] = x.Exp(x, big.NewInt(2), sra.MODP1024.N).Bytes()
+				return pool
+			},
+			want: "shuffle: " + sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "missing tile",
+			tamper: func(pool [][]byte) [][]byte {
+				return pool[1:]
+			},
+			want: "pool has 105 tiles",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const nPlayers = 3
+			// Tamper with the first shuffled pool, sent after the
+			// parameters, gameplay order and key commitment
+			// messages.
+			var n int
+			var culpritKey ed25519.PublicKey
+			ms, errs := runGame(t, sra.MODP1024.RestrictToSubgroup(), nPlayers, func(msg *Message) {
+				n++
+				if n != 4*nPlayers+1 {
+					return
+				}
+				culpritKey = msg.From
+				var pm poolMessage
+				decodeMessage(t, msg, &pm)
+				pm.Pool = tt.tamper(pm.Pool)
+				encodeMessage(t, msg, pm)
+			})
+			culprit := ms[0].Player(culpritKey)
+			for i, err := range errs {
+				var perr *ProtocolError
+				if !errors.As(err, &perr) {
+					t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+					continue
+				}
+				if perr.Player != culprit {
+					t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+				}
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStateMachineInvalidRekey(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(pm *poolMessage)
+		want   string
+	}{
+		{
+			name: "substituted tile",
+			tamper: func(pm *poolMessage) {
+				x := new(big.Int).SetBytes(pm.Pool[0])
+				pm.Pool[0] = x.Exp(x, big.NewInt(2), sra.MODP1024.N).Bytes()
+			},
+			want: "rekey: tile 0: " + sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "swapped tiles",
+			tamper: func(pm *poolMessage) {
+				pm.Pool[0], pm.Pool[1] = pm.Pool[1], pm.Pool[0]
+			},
+			want: "rekey: tile 0: " + sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "missing proof",
+			tamper: func(pm *poolMessage) {
+				pm.Proofs = pm.Proofs[1:]
+			},
+			want: "rekeyed 106 tiles with 105 proofs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const nPlayers = 3
+			// Tamper with the first rekeyed pool, sent after the
+			// parameters, gameplay order, key commitment and
+			// shuffle messages.
+			var n int
+			var culpritKey ed25519.PublicKey
+			ms, errs := runGame(t, sra.MODP1024.RestrictToSubgroup(), nPlayers, func(msg *Message) {
+				n++
+				if n != 5*nPlayers+1 {
+					return
+				}
+				culpritKey = msg.From
+				var pm poolMessage
+				decodeMessage(t, msg, &pm)
+				tt.tamper(&pm)
+				encodeMessage(t, msg, pm)
+			})
+			culprit := ms[0].Player(culpritKey)
+			for i, err := range errs {
+				var perr *ProtocolError
+				if !errors.As(err, &perr) {
+					t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+					continue
+				}
+				if perr.Player != culprit {
+					t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+				}
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStateMachineForgedOrderSecret(t *testing.T) {
+	const nPlayers = 3
+	// Tamper with the first revealed secret, sent after the parameters and
+	// the commitments to the secrets.
+	var n int
+	var culpritKey ed25519.PublicKey
+	ms, errs := runGame(t, sra.P256, nPlayers, func(msg *Message) {
+		n++
+		if n != 2*nPlayers+1 {
+			return
+		}
+		culpritKey = msg.From
+		var o commit.Opening
+		decodeMessage(t, msg, &o)
+		o.Value[0] ^= 1
+		encodeMessage(t, msg, o)
+	})
+	culprit := ms[0].Player(culpritKey)
+	for i, err := range errs {
+		if i+1 == culprit {
+			// The culprit sees its own message corrupted.
+			if err == nil {
+				t.Errorf("player #%d: got nil error", i+1)
+			}
+			continue
+		}
+		var perr *ProtocolError
+		if !errors.As(err, &perr) {
+			t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+			continue
+		}
+		if perr.Player != culprit {
+			t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+		}
+		if !errors.Is(err, commit.ErrInvalidOpening) {
+			t.Errorf("player #%d: got error %v, want %v", i+1, err, commit.ErrInvalidOpening)
+		}
+	}
+}
+
+func TestStateMachineBogusReveal(t *testing.T) {
+	const nPlayers = 3
+	params := sra.MODP1024.RestrictToSubgroup()
+	tests := []struct {
+		name   string
+		tamper func(msg *revealMessage)
+		want   string
+	}{
+		{
+			name: "wrong value",
+			tamper: func(msg *revealMessage) {
+				// Pretend the tile was already fully decrypted.
+				p, err := params.MapToSubgroup([]byte{2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				msg.Values[0] = p
+			},
+			want: sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "wrong proof",
+			tamper: func(msg *revealMessage) {
+				msg.Proofs[0], msg.Proofs[1] = msg.Proofs[1], msg.Proofs[0]
+			},
+			want: sra.ErrInvalidProof.Error(),
+		},
+		{
+			name: "missing proof",
+			tamper: func(msg *revealMessage) {
+				msg.Proofs = msg.Proofs[1:]
+			},
+			want: "revealed 28 tiles with 27 proofs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Tamper with the first reveal, sent after the parameters,
+			// gameplay order, key commitment, shuffle and rekey
+			// messages.
+			var n int
+			var culpritKey ed25519.PublicKey
+			ms, errs := runGame(t, params, nPlayers, func(msg *Message) {
+				n++
+				if n != 6*nPlayers+1 {
+					return
+				}
+				culpritKey = msg.From
+				var rm revealMessage
+				decodeMessage(t, msg, &rm)
+				tt.tamper(&rm)
+				encodeMessage(t, msg, rm)
+			})
+			culprit := ms[0].Player(culpritKey)
+			for i, err := range errs {
+				var perr *ProtocolError
+				if !errors.As(err, &perr) {
+					t.Errorf("player #%d: got error %v, want ProtocolError", i+1, err)
+					continue
+				}
+				if perr.Player != culprit {
+					t.Errorf("player #%d: blamed player #%d, want #%d", i+1, perr.Player, culprit)
+				}
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("player #%d: got %q, want substring %q", i+1, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func decodeMessage(t *testing.T, msg *Message, v interface{}) {
+	t.Helper()
+	if err := gob.NewDecoder(bytes.NewReader(msg.Data)).Decode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func encodeMessage(t *testing.T, msg *Message, v interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		t.Error(err)
+	}
+	msg.Data = buf.Bytes()
+}
+
+// runGame runs nPlayers machines using params connected by an in-memory
+// broadcast network until all of them terminate. If tamper is not nil, it is
+// called to modify every message before it is delivered. The randomness of all
+// players is derived from a seed, logged such that a failing game can be
+// replayed with -seed. Options configure each machine before it runs.
+func runGame(t *testing.T, params *sra.Params, nPlayers int, tamper func(*Message), opts ...func(*Machine)) ([]*Machine, []error) {
+	t.Helper()
+	var seed []byte
+	if *seedFlag != "" {
+		var err error
+		if seed, err = hex.DecodeString(*seedFlag); err != nil {
+			t.Fatalf("invalid -seed: %v", err)
+		}
+	} else {
+		seed = make([]byte, 16)
+		if _, err := rand.Read(seed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("seed: %x", seed)
+	return runGameSeed(t, params, nPlayers, seed, tamper, opts...)
+}
+
+// runGameSeed is like runGame, with the given seed.
+func runGameSeed(t *testing.T, params *sra.Params, nPlayers int, seed []byte, tamper func(*Message), opts ...func(*Machine)) ([]*Machine, []error) {
+	t.Helper()
+	ms := newGame(t, params, nPlayers, seed, opts...)
+	return ms, broadcast(ms, tamper, (*Machine).Run)
+}
+
+// newGame returns the machines of nPlayers players using params, whose
+// randomness is derived from seed, configured by options.
+func newGame(t *testing.T, params *sra.Params, nPlayers int, seed []byte, opts ...func(*Machine)) []*Machine {
+	t.Helper()
+	keys, players := newIdentities(t, nPlayers, seed)
+	ms := make([]*Machine, nPlayers)
+	for i := range ms {
+		ms[i] = &Machine{
+			Players:  players,
+			Identity: keys[i],
+			Params:   params,
+			GameID:   t.Name(),
+			// Few rounds keep tests fast, soundness is tested
+			// in package sra.
+			ShuffleRounds: 8,
+			Rand:          tiwerand.NewDeterministic(append([]byte{byte(i)}, seed...)),
+		}
+		for _, opt := range opts {
+			opt(ms[i])
+		}
+	}
+	return ms
+}
+
+// newIdentities returns the signing keys and identities of n players, derived
+// from seed.
+func newIdentities(t *testing.T, n int, seed []byte) ([]ed25519.PrivateKey, []ed25519.PublicKey) {
+	t.Helper()
+	random := tiwerand.NewDeterministic(append([]byte("identities"), seed...))
+	keys := make([]ed25519.PrivateKey, n)
+	players := make([]ed25519.PublicKey, n)
+	for i := range keys {
+		var err error
+		if keys[i], err = identity.New(random); err != nil {
+			t.Fatal(err)
+		}
+		players[i] = keys[i].Public().(ed25519.PublicKey)
+	}
+	return keys, players
+}
+
+// A fakePeer signs messages as a player, for tests that drive a machine by
+// hand.
+type fakePeer struct {
+	key    ed25519.PrivateKey
+	gameID string
+	seq    uint64
+}
+
+// newPeers returns a machine for player #whoAmI of n players, and peers for
+// all players but whoAmI, which are nil.
+func newPeers(t *testing.T, n, whoAmI int) (*Machine, []*fakePeer) {
+	t.Helper()
+	keys, players := newIdentities(t, n, []byte(t.Name()))
+	m := &Machine{Players: players, Identity: keys[whoAmI-1], GameID: t.Name()}
+	peers := make([]*fakePeer, n)
+	for i, key := range keys {
+		if i+1 != whoAmI {
+			peers[i] = &fakePeer{key: key, gameID: m.GameID}
+		}
+	}
+	return m, peers
+}
 
-		debug: true,
+// raw returns a message with data, signed by p.
+func (p *fakePeer) raw(data []byte) Message {
+	msg := Message{
+		From:      p.key.Public().(ed25519.PublicKey),
+		Seq:       p.seq,
+		Data:      data,
+		Signature: identity.Sign(p.key, p.gameID, p.seq, data),
 	}
+	p.seq++
+	return msg
+}
+
+// message returns a message with v encoded with encoding/gob, signed by p.
+func (p *fakePeer) message(t *testing.T, v interface{}) Message {
+	t.Helper()
+	var msg Message
+	encodeMessage(t, &msg, v)
+	return p.raw(msg.Data)
+}
+
+// broadcast connects machines by an in-memory broadcast network, replacing
+// their In and Out channels, and calls run for each machine concurrently until
+// all of them return. If tamper is not nil, it is called to modify every
+// message before it is delivered. Messages whose data is modified are signed
+// again by their sender, such that tamper models a cheating player. Messages
+// whose From is set to nil are dropped.
+func broadcast(ms []*Machine, tamper func(*Message), run func(*Machine) error) []error {
+	keys := make(map[string]ed25519.PrivateKey)
+	for _, m := range ms {
+		keys[string(m.Identity.Public().(ed25519.PublicKey))] = m.Identity
+	}
+	out := make(chan Message, 1024)
+	ins := make([]chan Message, len(ms))
+	for i, m := range ms {
+		ins[i] = make(chan Message, 1024)
+		m.In = ins[i]
+		m.Out = out
+	}
+	stop := make(chan struct{})
 	go func() {
-		msg1 := <-out
-		in <- msg1
+		defer func() {
+			for _, in := range ins {
+				close(in)
+			}
+		}()
+		for {
+			select {
+			case msg := <-out:
+				if tamper != nil {
+					data := msg.Data
+					tamper(&msg)
+					if msg.From == nil {
+						continue
+					}
+					if key := keys[string(msg.From)]; key != nil && !bytes.Equal(msg.Data, data) {
+						msg.Signature = identity.Sign(key, ms[0].GameID, msg.Seq, msg.Data)
+					}
+				}
+				for _, in := range ins {
+					in <- msg
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	type result struct {
+		i   int
+		err error
+	}
+	results := make(chan result)
+	for i, m := range ms {
+		i, m := i, m
+		go func() {
+			results <- result{i, run(m)}
+		}()
+	}
+	errs := make([]error, len(ms))
+	stopped := false
+	for range ms {
+		r := <-results
+		errs[r.i] = r.err
+		// Unblock other players waiting for messages.
+		if r.err != nil && !stopped {
+			close(stop)
+			stopped = true
+		}
+	}
+	if !stopped {
+		close(stop)
+	}
+	return errs
+}
 
-		s2 := []byte("foo")
-		h2 := blake2b.Sum256(s2)
-		in <- Message{
-			From: 2,
-			Data: h2[:],
+func TestStateMachineReplay(t *testing.T) {
+	const nPlayers = 2
+	seed := []byte("replay")
+	var runs [2][]Message
+	for i := range runs {
+		i := i
+		_, errs := runGameSeed(t, sra.P256, nPlayers, seed, func(msg *Message) {
+			runs[i] = append(runs[i], *msg)
+		})
+		for j, err := range errs {
+			if err != nil {
+				t.Fatalf("run %d: player #%d: %v", i, j+1, err)
+			}
 		}
+	}
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Errorf("games with the same seed differ")
+	}
+}
 
-		s3 := []byte("bar")
-		h3 := blake2b.Sum256(s3)
-		in <- Message{
-			From: 3,
-			Data: h3[:],
+func TestStateMachineGameplayOrder(t *testing.T) {
+	in := make(chan Message, 1)
+	out := make(chan Message, 1)
+	m, peers := newPeers(t, 3, 1)
+	m.In = in
+	m.Out = out
+	m.debug = true
+	id := setupDigest(t, 3, func(*Machine) {})
+	go func() {
+		in <- <-out
+		in <- peers[1].raw(id)
+		in <- peers[2].raw(id)
+
+		msg1 := <-out
+		in <- msg1
+
+		commitTo := func(player int, s string) commit.Opening {
+			d := commit.Domain{GameID: m.GameID, Phase: "gameplay order", Player: player}
+			c, o, err := commit.Commit(nil, d, []byte(s))
+			if err != nil {
+				t.Error(err)
+			}
+			in <- peers[player-1].message(t, c)
+			return o
 		}
+		o2 := commitTo(2, "secret 2")
+		o3 := commitTo(3, "secret 3")
 
 		in <- <-out
-		in <- Message{2, s2}
-		in <- Message{3, s3}
+		for i, o := range []commit.Opening{o2, o3} {
+			in <- peers[i+1].message(t, o)
+		}
 
-		in <- Message{}
+		close(in)
 	}()
-	err := m.Run()
-	if err != nil {
+	if err := m.Run(); err == nil {
+		t.Fatal("got nil error, want error after input closed")
+	}
+	order := append([]int(nil), m.order...)
+	sort.Ints(order)
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(order, want) {
+		t.Errorf("gameplay order %v is not a permutation of %v", m.order, want)
+	}
+}
+
+func TestStateMachineParamsMismatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		mine, peer func(m *Machine)
+	}{
+		{
+			name: "params",
+			mine: func(m *Machine) { m.Params = sra.MODP2048.RestrictToSubgroup() },
+			peer: func(m *Machine) { m.Params = sra.MODP3072.RestrictToSubgroup() },
+		},
+		{
+			name: "rules",
+			mine: func(m *Machine) { m.Rules = &game.Rules{InitialMeld: 39} },
+			peer: func(m *Machine) { m.Rules = &game.Rules{InitialMeld: 1000} },
+		},
+		{
+			name: "escrow threshold",
+			mine: func(m *Machine) { m.EscrowThreshold = 0 },
+			peer: func(m *Machine) { m.EscrowThreshold = 1 },
+		},
+		{
+			name: "reveal timeout",
+			mine: func(m *Machine) { m.RevealTimeout = time.Second },
+			peer: func(m *Machine) { m.RevealTimeout = time.Minute },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan Message, 1)
+			out := make(chan Message, 1)
+			m, peers := newPeers(t, 2, 1)
+			m.In = in
+			m.Out = out
+			m.Params = sra.P256
+			tt.mine(m)
+			digest := setupDigest(t, 2, func(m *Machine) {
+				m.Params = sra.P256
+				tt.peer(m)
+			})
+			go func() {
+				in <- <-out
+				in <- peers[1].raw(digest)
+			}()
+			err := m.Run()
+			if err == nil {
+				t.Fatal("got nil error, want mismatch")
+			}
+			if got, want := err.Error(), "player #2 violated the protocol: different parameters or rules"; !strings.Contains(got, want) {
+				t.Errorf("got %q, want substring %q", got, want)
+			}
+		})
+	}
+}
+
+// setupDigest returns the digest sent in the setup by a machine of n players
+// configured with opt.
+func setupDigest(t *testing.T, n int, opt func(*Machine)) []byte {
+	t.Helper()
+	m, _ := newPeers(t, n, 1)
+	m.In = make(chan Message)
+	m.Out = make(chan Message)
+	opt(m)
+	if err := m.setup(); err != nil {
 		t.Fatal(err)
 	}
+	return m.setupDigest()
+}
+
+func TestStateMachineNoGenerator(t *testing.T) {
+	for _, params := range []*sra.Params{sra.DefaultParams, sra.MODP1024} {
+		m, _ := newPeers(t, 2, 1)
+		out := make(chan Message, 1)
+		m.In = make(chan Message)
+		m.Out = out
+		m.Params = params
+		if err := m.Run(); !errors.Is(err, sra.ErrNoGenerator) {
+			t.Errorf("%s: got error %v, want %v", params.Name, err, sra.ErrNoGenerator)
+		}
+		if len(out) != 0 {
+			t.Errorf("%s: sent a message before checking the parameters", params.Name)
+		}
+	}
+}
+
+func TestStateMachineUnsignedMessage(t *testing.T) {
+	id := setupDigest(t, 3, func(m *Machine) { m.Params = sra.P256 })
+	strangers, _ := newIdentities(t, 1, []byte("strangers"))
+	tests := []struct {
+		name string
+		msgs func(peers []*fakePeer) []Message
+		want error
+	}{
+		{
+			name: "forged sender",
+			msgs: func(peers []*fakePeer) []Message {
+				msg := peers[2].raw(id)
+				msg.From = peers[1].key.Public().(ed25519.PublicKey)
+				return []Message{msg}
+			},
+			want: identity.ErrInvalidSignature,
+		},
+		{
+			name: "altered data",
+			msgs: func(peers []*fakePeer) []Message {
+				msg := peers[1].raw(id)
+				msg.Data = append([]byte(nil), msg.Data...)
+				msg.Data[0] ^= 1
+				return []Message{msg}
+			},
+			want: identity.ErrInvalidSignature,
+		},
+		{
+			name: "replayed",
+			msgs: func(peers []*fakePeer) []Message {
+				msg := peers[1].raw(id)
+				return []Message{msg, msg}
+			},
+			want: errors.New("out of sequence"),
+		},
+		{
+			name: "unknown player",
+			msgs: func(peers []*fakePeer) []Message {
+				stranger := &fakePeer{key: strangers[0]}
+				return []Message{stranger.raw(id)}
+			},
+			want: errors.New("unknown player"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan Message, 3)
+			out := make(chan Message, 1)
+			m, peers := newPeers(t, 3, 1)
+			m.In = in
+			m.Out = out
+			m.Params = sra.P256
+			go func() {
+				in <- <-out
+				for _, msg := range tt.msgs(peers) {
+					in <- msg
+				}
+				close(in)
+			}()
+			err := m.Run()
+			if err == nil {
+				t.Fatal("got nil error, want error")
+			}
+			var perr *ProtocolError
+			if errors.As(err, &perr) {
+				t.Errorf("got %v, want error not attributed to a player", err)
+			}
+			if !errors.Is(err, tt.want) && !strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// brokenReader is a random source that always fails.
+type brokenReader struct{}
+
+var errBroken = errors.New("broken random source")
+
+func (brokenReader) Read(p []byte) (int, error) { return 0, errBroken }
+
+func TestStateMachineEmptyGameID(t *testing.T) {
+	m, _ := newPeers(t, 2, 1)
+	m.In = make(chan Message)
+	m.Out = make(chan Message)
+	m.GameID = ""
+	if err := m.Run(); err == nil || !strings.Contains(err.Error(), "game ID") {
+		t.Errorf("got error %v, want missing game ID", err)
+	}
+}
+
+func TestStateMachineBrokenRand(t *testing.T) {
+	m, _ := newPeers(t, 2, 1)
+	m.In = make(chan Message)
+	m.Out = make(chan Message)
+	m.Rand = tiwerand.NewSource(brokenReader{})
+	if err := m.Run(); !errors.Is(err, errBroken) {
+		t.Errorf("got error %v, want %v", err, errBroken)
+	}
 }
 
 func TestXor(t *testing.T) {